@@ -0,0 +1,167 @@
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/rotate"
+	"zid-logs/internal/state"
+	"zid-logs/internal/timestamp"
+)
+
+// shippedOffset retorna ate onde o envio leu o log vivo; false quando o
+// checkpoint e de outro arquivo ou o envio esta desligado.
+func (h *rotationHooks) shippedOffset() (int64, bool) {
+	if h.st == nil || (h.input.Policy.ShipEnabled != nil && !*h.input.Policy.ShipEnabled) {
+		return 0, false
+	}
+	info, err := os.Stat(h.input.Path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	cp, ok, err := h.st.GetCheckpoint(h.input.Package, h.input.LogID, h.input.Path)
+	if err != nil || !ok || cp.Identity.Inode != uint64(stat.Ino) || cp.Identity.Dev != uint64(stat.Dev) {
+		return 0, false
+	}
+	return cp.LastOffset, true
+}
+
+// ArchiveAdded registra a geracao so com o tamanho e a marca de envio; o
+// resumo vem depois, em Describe.
+func (h *rotationHooks) ArchiveAdded(path, archive string) {
+	info, err := os.Stat(archive)
+	if err != nil {
+		log.Printf("erro ao catalogar %s: %v", archive, err)
+		return
+	}
+	h.archived = info.Size()
+	if h.st == nil {
+		return
+	}
+	entry := state.ArchiveEntry{
+		Package:   h.input.Package,
+		LogID:     h.input.LogID,
+		Path:      path,
+		Name:      archive,
+		Size:      info.Size(),
+		Shipped:   h.shipped >= info.Size(),
+		RotatedAt: time.Now().Unix(),
+	}
+	if err := h.st.SaveArchive(entry); err != nil {
+		log.Printf("erro ao catalogar %s: %v", archive, err)
+	}
+}
+
+// Describe calcula SHA-256 e primeiro/ultimo timestamp das geracoes de path
+// ainda sem resumo; as que ja foram comprimidas ou removidas ficam sem.
+func (h *rotationHooks) Describe(path string) {
+	if h.st == nil {
+		return
+	}
+	entries, err := h.st.ListArchives(path)
+	if err != nil {
+		return
+	}
+	parser, err := timestamp.For(h.input)
+	if err != nil {
+		parser = nil
+	}
+	for _, entry := range entries {
+		if entry.SHA256 != "" {
+			continue
+		}
+		summary, err := rotate.Summarize(entry.Name, parser)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("erro ao catalogar %s: %v", entry.Name, err)
+			}
+			continue
+		}
+		entry.Size = summary.Size
+		entry.SHA256 = summary.SHA256
+		if !summary.First.IsZero() {
+			entry.FirstTime = summary.First.Unix()
+		}
+		if !summary.Last.IsZero() {
+			entry.LastTime = summary.Last.Unix()
+		}
+		if err := h.st.SaveArchive(entry); err != nil {
+			log.Printf("erro ao catalogar %s: %v", entry.Name, err)
+		}
+	}
+}
+
+func (h *rotationHooks) ArchiveRenamed(from, to string) {
+	if h.st == nil {
+		return
+	}
+	if err := h.st.RenameArchive(from, to); err != nil {
+		log.Printf("erro ao atualizar catalogo %s -> %s: %v", from, to, err)
+	}
+}
+
+func (h *rotationHooks) ArchiveRemoved(archive string) {
+	if h.st == nil {
+		return
+	}
+	if err := h.st.DeleteArchive(archive); err != nil {
+		log.Printf("erro ao atualizar catalogo %s: %v", archive, err)
+	}
+}
+
+// catalogCompressed guarda no catalogo o tamanho comprimido de uma geracao.
+func catalogCompressed(st *state.State, result rotate.CompressResult) {
+	if st == nil || result.Err != nil {
+		return
+	}
+	entry, ok, err := st.GetArchive(rotate.ArchiveName(result.Archive))
+	if err != nil || !ok {
+		return
+	}
+	entry.File = result.Archive
+	entry.CompressedSize = result.Bytes
+	_ = st.SaveArchive(entry)
+}
+
+// loadCatalog le o catalogo de todos os logs, do state ou, com o daemon
+// rodando, do ultimo status salvo.
+func loadCatalog() map[string][]state.ArchiveEntry {
+	catalog := make(map[string][]state.ArchiveEntry)
+	st, err := state.OpenReadOnly(config.StateDBPath)
+	if err == nil {
+		defer st.Close()
+		entries, err := st.ListArchives("")
+		if err != nil {
+			return catalog
+		}
+		for _, e := range rotate.Present(entries) {
+			catalog[e.Path] = append(catalog[e.Path], e)
+		}
+		return catalog
+	}
+	snapshot, ok, err := loadStatusSnapshot()
+	if err != nil || !ok {
+		return catalog
+	}
+	for _, input := range snapshot.Inputs {
+		catalog[input.Path] = append(catalog[input.Path], input.Archives...)
+	}
+	return catalog
+}
+
+// findCataloged retorna a geracao cujo intervalo de timestamps contem at.
+func findCataloged(entries []state.ArchiveEntry, at time.Time) (state.ArchiveEntry, bool) {
+	for _, e := range entries {
+		if e.Contains(at.Unix()) {
+			return e, true
+		}
+	}
+	return state.ArchiveEntry{}, false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"zid-logs/internal/rotate"
+	"zid-logs/internal/state"
+)
+
+const (
+	historyOK     = "ok"
+	historyVetoed = "vetoed"
+	historyError  = "error"
+)
+
+const defaultHistoryLimit = 50
+
+// begin comeca o registro de uma rotacao do input.
+func (h *rotationHooks) begin(trigger string) {
+	h.history = state.RotationRecord{
+		Package: h.input.Package,
+		LogID:   h.input.LogID,
+		Path:    h.input.Path,
+		Trigger: trigger,
+	}
+	h.started = time.Now()
+}
+
+// finish grava no historico a rotacao feita, vetada ou que falhou; quando nada
+// precisou ser rotacionado nao ha registro.
+func (h *rotationHooks) finish(rotated bool, err error) {
+	h.resume()
+	h.scheduleReopen()
+	if h.st == nil || h.started.IsZero() || (!rotated && err == nil) || os.IsNotExist(err) {
+		return
+	}
+	record := h.history
+	record.DurationMs = time.Since(h.started).Milliseconds()
+	switch {
+	case errors.Is(err, rotate.ErrVetoed):
+		record.Result = historyVetoed
+		record.Error = err.Error()
+	case err != nil:
+		record.Result = historyError
+		record.Error = err.Error()
+	default:
+		record.Result = historyOK
+	}
+	if record.Result == historyOK && record.Archive != "" {
+		if name, size, ok := rotate.Locate(record.Archive); ok {
+			record.Archive, record.ArchiveBytes = name, size
+		}
+	}
+	if err := h.st.AddRotationRecord(record); err != nil {
+		log.Printf("erro ao gravar historico de %s: %v", h.input.Path, err)
+	}
+	h.started = time.Time{}
+}
+
+// historyCmd mostra o historico de rotacoes, opcionalmente de um package ou
+// log: zid-logs history rotate [package [log_id]] [-n N].
+func historyCmd(args []string) {
+	if len(args) < 1 || args[0] != "rotate" {
+		fmt.Fprintln(os.Stderr, "Usage: zid-logs history rotate [package [log_id]] [-n N]")
+		os.Exit(2)
+	}
+	limit := defaultHistoryLimit
+	var filter []string
+	for i := 1; i < len(args); i++ {
+		if args[i] == "-n" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				fmt.Fprintf(os.Stderr, "limite invalido: %s\n", args[i+1])
+				os.Exit(2)
+			}
+			limit = n
+			i++
+			continue
+		}
+		filter = append(filter, args[i])
+	}
+	pkg, logID := "", ""
+	if len(filter) > 0 {
+		pkg = filter[0]
+	}
+	if len(filter) > 1 {
+		logID = filter[1]
+	}
+
+	_, _, st, err := loadAllReadOnly()
+	var records []state.RotationRecord
+	if err != nil {
+		// com o daemon rodando o state.db fica ocupado; usa o ultimo status
+		snapshot, ok, snapErr := loadStatusSnapshot()
+		if !ok || snapErr != nil {
+			fmt.Fprintf(os.Stderr, "erro ao carregar configuracoes: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "state.db ocupado; exibindo historico do ultimo status salvo")
+		for _, r := range snapshot.RotationHistory {
+			if (pkg == "" || r.Package == pkg) && (logID == "" || r.LogID == logID) && len(records) < limit {
+				records = append(records, r)
+			}
+		}
+	} else {
+		if st != nil {
+			defer st.Close()
+			records, err = st.ListRotationHistory(pkg, logID, "", limit)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro ao ler historico: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if records == nil {
+		records = []state.RotationRecord{}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro ao gerar saida: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"zid-logs/internal/hook"
+	"zid-logs/internal/managed"
+	"zid-logs/internal/registry"
+	"zid-logs/internal/state"
+)
+
+// rotationHooks liga pre_rotate/post_rotate do input a rotacao. O resultado
+// de cada hook fica no checkpoint (status) e no historico da rotacao; falhas
+// viram evento. Tambem mantem o catalogo de arquivos rotacionados, com o
+// quanto o envio ja tinha lido do log antes de ele mudar de nome (shipped,
+// valido com tracked) e o tamanho do arquivo rotacionado (archived).
+type rotationHooks struct {
+	input    registry.LogInput
+	st       *state.State
+	history  state.RotationRecord
+	started  time.Time
+	shipped  int64
+	tracked  bool
+	archived int64
+	reopen   *os.File
+	hold     func()
+}
+
+func (h *rotationHooks) PreRotate(archive string, cut time.Time) error {
+	h.history.Archive = archive
+	h.history.CutTime = cut.Unix()
+	h.shipped, h.tracked = h.shippedOffset()
+	h.archived = 0
+	if h.input.PreRotate != nil {
+		result := hook.Run(context.Background(), hook.PreRotate, *h.input.PreRotate, h.env(archive, cut))
+		h.record(result)
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	h.hold = managed.Hold(h.input.Path)
+	return nil
+}
+
+// resume libera o writer gerenciado pausado em PreRotate.
+func (h *rotationHooks) resume() {
+	if h.hold != nil {
+		h.hold()
+		h.hold = nil
+	}
+}
+
+// PostRotate sinaliza o programa (post_rotate_pidfile/match) e depois roda o
+// post_rotate; post_rotate_command (legado) vira o post_rotate com timeout
+// default.
+func (h *rotationHooks) PostRotate(archive string, cut time.Time) {
+	h.resume()
+	if err := signalPostRotate(h.input); err != nil {
+		log.Printf("post-rotate falhou %s: %v", h.input.Path, err)
+	}
+	cfg := postRotateHook(h.input)
+	if cfg != nil {
+		result := hook.Run(context.Background(), hook.PostRotate, *cfg, h.env(archive, cut))
+		h.record(result)
+	}
+	if cfg != nil || h.input.PostRotatePidfile != "" || processMatch(h.input) != nil {
+		h.verifyReopen(archive)
+	}
+}
+
+// reopenCheckDelay e quanto esperar, depois do post-rotate, para conferir se
+// o programa parou de gravar no arquivo rotacionado.
+const reopenCheckDelay = 5 * time.Second
+
+// verifyReopen guarda um descritor do arquivo rotacionado, que continua
+// valido se ele for renomeado, comprimido ou removido; a conferencia e
+// agendada em scheduleReopen, quando a rotacao termina.
+func (h *rotationHooks) verifyReopen(archive string) {
+	if h.reopen != nil {
+		h.reopen.Close()
+	}
+	file, err := os.Open(archive)
+	if err != nil {
+		h.reopen = nil
+		return
+	}
+	h.reopen = file
+}
+
+// scheduleReopen agenda a conferencia a partir do tamanho do arquivo
+// rotacionado no fim da rotacao (no corte por timestamp, ja truncado no
+// corte).
+func (h *rotationHooks) scheduleReopen() {
+	file := h.reopen
+	h.reopen = nil
+	if file == nil {
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+	archive := h.history.Archive
+	if archive == "" {
+		archive = file.Name()
+	}
+	reopens.add(reopenCheck{
+		input:   h.input,
+		archive: archive,
+		file:    file,
+		before:  info.Size(),
+		due:     time.Now().Add(reopenCheckDelay),
+	})
+}
+
+// reopenCheck confere se o arquivo rotacionado ainda cresce depois de
+// reopenCheckDelay: o programa nao reabriu o log.
+type reopenCheck struct {
+	input   registry.LogInput
+	archive string
+	file    *os.File
+	before  int64
+	due     time.Time
+}
+
+func (c reopenCheck) run(st *state.State) {
+	defer c.file.Close()
+	info, err := c.file.Stat()
+	if err != nil || info.Size() <= c.before {
+		return
+	}
+	detail := fmt.Sprintf("%s recebeu %d bytes depois do post-rotate", c.archive, info.Size()-c.before)
+	log.Printf("programa nao reabriu %s: %s", c.input.Path, detail)
+	addEvent(st, state.Event{
+		Kind:    "reopen_warning",
+		Package: c.input.Package,
+		LogID:   c.input.LogID,
+		Path:    c.input.Path,
+		Detail:  detail,
+	})
+}
+
+// reopenQueue guarda as conferencias pendentes, sempre usada sob o mu do
+// daemon ou no comando rotate. O daemon roda as vencidas no loop (run) com o
+// state aberto naquele momento; o comando rotate espera por todas (wait).
+type reopenQueue struct {
+	pending []reopenCheck
+}
+
+var reopens reopenQueue
+
+func (q *reopenQueue) add(c reopenCheck) {
+	q.pending = append(q.pending, c)
+}
+
+// run roda as conferencias vencidas ate now.
+func (q *reopenQueue) run(st *state.State, now time.Time) {
+	var keep []reopenCheck
+	for _, c := range q.pending {
+		if c.due.After(now) {
+			keep = append(keep, c)
+			continue
+		}
+		c.run(st)
+	}
+	q.pending = keep
+}
+
+// wait espera a ultima conferencia pendente vencer e roda todas.
+func (q *reopenQueue) wait(st *state.State) {
+	var last time.Time
+	for _, c := range q.pending {
+		if c.due.After(last) {
+			last = c.due
+		}
+	}
+	time.Sleep(time.Until(last))
+	q.run(st, last)
+}
+
+// stop descarta as conferencias pendentes.
+func (q *reopenQueue) stop() {
+	for _, c := range q.pending {
+		c.file.Close()
+	}
+	q.pending = nil
+}
+
+func postRotateHook(input registry.LogInput) *registry.HookConfig {
+	if input.PostRotate != nil {
+		return input.PostRotate
+	}
+	if input.PostRotateCommand != "" {
+		return &registry.HookConfig{Command: input.PostRotateCommand}
+	}
+	return nil
+}
+
+func (h *rotationHooks) env(archive string, cut time.Time) hook.Env {
+	return hook.Env{
+		Package: h.input.Package,
+		LogID:   h.input.LogID,
+		Path:    h.input.Path,
+		Archive: archive,
+		CutTime: cut,
+	}
+}
+
+func (h *rotationHooks) record(result hook.Result) {
+	if result.Err != nil {
+		log.Printf("%s %s: %v", result.Hook, h.input.Path, result.Err)
+	}
+	if h.st == nil {
+		return
+	}
+	run := state.HookRun{
+		At:         time.Now().Unix(),
+		ExitCode:   result.ExitCode,
+		DurationMs: result.Duration.Milliseconds(),
+	}
+	if result.Err != nil {
+		run.Error = result.Err.Error()
+		addEvent(h.st, state.Event{
+			Kind:    result.Hook + "_error",
+			Package: h.input.Package,
+			LogID:   h.input.LogID,
+			Path:    h.input.Path,
+			Detail:  run.Error,
+		})
+	}
+	cp, ok, err := h.st.GetCheckpoint(h.input.Package, h.input.LogID, h.input.Path)
+	if err != nil {
+		return
+	}
+	if !ok {
+		cp = state.Checkpoint{Package: h.input.Package, LogID: h.input.LogID, Path: h.input.Path}
+	}
+	if result.Hook == hook.PreRotate {
+		cp.PreRotate = run
+		h.history.PreRotate = &run
+	} else {
+		cp.PostRotate = run
+		h.history.PostRotate = &run
+	}
+	_ = h.st.SaveCheckpoint(cp)
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strconv"
@@ -16,18 +15,36 @@ import (
 	"syscall"
 	"time"
 
+	"zid-logs/internal/budget"
+	"zid-logs/internal/collect"
 	"zid-logs/internal/config"
+	"zid-logs/internal/hook"
+	"zid-logs/internal/ingest"
+	"zid-logs/internal/proc"
 	"zid-logs/internal/registry"
 	"zid-logs/internal/rotate"
+	"zid-logs/internal/schedule"
 	"zid-logs/internal/shipper"
 	"zid-logs/internal/state"
 	"zid-logs/internal/status"
+	"zid-logs/internal/stream"
+	"zid-logs/internal/throttle"
+	"zid-logs/internal/timestamp"
+	"zid-logs/internal/watch"
 
 	bolt "go.etcd.io/bbolt"
 )
 
 var version = "dev" // sobrescrito via -ldflags
 
+// compressor comprime os arquivos rotacionados em segundo plano no daemon;
+// nos comandos avulsos fica nil e a compressao acontece na propria rotacao.
+var compressor *rotate.Compressor
+
+// diskUsage e a ultima medicao do disk_budget feita por enforceDiskBudget,
+// usada pelo status em vez de medir de novo.
+var diskUsage *budget.Usage
+
 const (
 	licensePackage       = "zid-logs"
 	licenseCheckInterval = 60 * time.Second
@@ -50,6 +67,10 @@ func main() {
 		statusCmd()
 	case "validate":
 		validateCmd()
+	case "archives":
+		archivesCmd(os.Args[2:])
+	case "history":
+		historyCmd(os.Args[2:])
 	case "version", "-version", "--version", "-v":
 		fmt.Printf("zid-logs version %s\n", version)
 	default:
@@ -59,7 +80,7 @@ func main() {
 }
 
 func usage() {
-	fmt.Println("Usage: zid-logs <run|rotate|ship|status|validate|version>")
+	fmt.Println("Usage: zid-logs <run|rotate|ship|status|validate|archives|history|version>")
 }
 
 func runCmd() {
@@ -83,6 +104,9 @@ func runCmd() {
 		log.Printf("zid-logs desabilitado")
 		return
 	}
+	recoverRotations(cfg, inputs, st)
+	compressor = rotate.NewCompressor()
+	defer compressor.Stop()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -98,28 +122,50 @@ func runCmd() {
 	shipTicker := startShipTicker(cfg)
 	defer rotateSched.Stop()
 	defer shipTicker.Stop()
+	reopenTicker := time.NewTicker(time.Second)
+	defer reopenTicker.Stop()
+	defer reopens.stop()
+
+	streamer := stream.Start(watch.New())
+	defer streamer.Stop()
+	updateStreamer(streamer, inputs)
+
+	ingestSrv := startIngest(cfg)
+	defer func() { stopIngest(ingestSrv) }()
+
+	collector := collect.NewManager()
+	defer collector.Stop()
+	collector.Update(inputs)
 
 	log.Printf("zid-logs iniciado")
 	writeStatusSnapshot(cfg, inputs, st, "")
 	rotateIfDue(cfg, inputs, st)
+	lastSizeCheck := time.Now()
 
 	for {
 		select {
 		case <-rotateSched.C:
 			mu.Lock()
-			inputs = refreshInputs(inputs)
+			inputs = refreshInputs(inputs, cfg, st)
+			updateStreamer(streamer, inputs)
+			collector.Update(inputs)
 			var lastErr string
-			if cfg.RotateAt != "" {
-				rotateIfDue(cfg, inputs, st)
-			} else if err := rotateAll(cfg, inputs, st, false); err != nil {
-				log.Printf("erro na rotacao: %v", err)
-				lastErr = err.Error()
+			rotateIfDue(cfg, inputs, st)
+			if time.Since(lastSizeCheck) >= rotateInterval(cfg) {
+				lastSizeCheck = time.Now()
+				if err := rotateAll(cfg, unscheduledInputs(cfg, inputs), st, false); err != nil {
+					log.Printf("erro na rotacao: %v", err)
+					lastErr = err.Error()
+				}
 			}
+			enforceDiskBudget(cfg, inputs, st)
 			writeStatusSnapshot(cfg, inputs, st, lastErr)
 			mu.Unlock()
 		case <-shipTicker.C():
 			mu.Lock()
-			inputs = refreshInputs(inputs)
+			inputs = refreshInputs(inputs, cfg, st)
+			updateStreamer(streamer, inputs)
+			collector.Update(inputs)
 			lastErr := ""
 			if err := shipAll(ctx, cfg, inputs, st); err != nil {
 				log.Printf("erro no envio: %v", err)
@@ -127,15 +173,40 @@ func runCmd() {
 			}
 			writeStatusSnapshot(cfg, inputs, st, lastErr)
 			mu.Unlock()
+		case <-streamer.C:
+			mu.Lock()
+			shipped, err := shipStreams(ctx, cfg, inputs, st, streamer)
+			if err != nil {
+				log.Printf("erro no envio (stream): %v", err)
+				writeStatusSnapshot(cfg, inputs, st, err.Error())
+			} else if shipped {
+				writeStatusSnapshot(cfg, inputs, st, "")
+			}
+			mu.Unlock()
+		case now := <-reopenTicker.C:
+			mu.Lock()
+			reopens.run(st, now)
+			mu.Unlock()
+		case result := <-compressor.C:
+			mu.Lock()
+			recordCompression(st, inputs, result)
+			mu.Unlock()
 		case <-reload:
 			mu.Lock()
 			_ = st.Close()
+			previous := inputs
 			cfg, inputs, st, err = loadAll()
 			if err != nil {
 				log.Printf("erro ao recarregar configuracoes: %v", err)
+			} else {
+				handleMissing(previous, inputs, st)
 			}
 			rotateSched.Update(cfg)
 			shipTicker.Update(cfg)
+			updateStreamer(streamer, inputs)
+			collector.Update(inputs)
+			stopIngest(ingestSrv)
+			ingestSrv = startIngest(cfg)
 			mu.Unlock()
 		case <-stop:
 			log.Printf("zid-logs encerrando")
@@ -162,17 +233,7 @@ func startRotateScheduler(cfg config.Config) *rotateScheduler {
 
 	go func() {
 		defer close(done)
-		var ticker *time.Ticker
-
-		if cfg.RotateAt != "" {
-			ticker = time.NewTicker(time.Minute)
-		} else {
-			interval := time.Duration(cfg.IntervalRotateSeconds) * time.Second
-			if interval <= 0 {
-				interval = 300 * time.Second
-			}
-			ticker = time.NewTicker(interval)
-		}
+		ticker := time.NewTicker(rotateTickInterval(cfg))
 
 		for {
 			select {
@@ -261,35 +322,21 @@ func resolveShipInterval(cfg config.Config) time.Duration {
 	return time.Hour
 }
 
-func nextRotateTime(now time.Time, rotateAt string) (time.Time, error) {
-	hour, minute, err := parseRotateAt(rotateAt)
-	if err != nil {
-		return time.Time{}, err
+// rotateTickInterval e o passo do agendador: no maximo um minuto, para que
+// agendas cron disparem no minuto certo.
+func rotateTickInterval(cfg config.Config) time.Duration {
+	interval := rotateInterval(cfg)
+	if interval > time.Minute {
+		return time.Minute
 	}
-	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
-	if !next.After(now) {
-		next = next.Add(24 * time.Hour)
-	}
-	return next, nil
+	return interval
 }
 
-func parseRotateAt(value string) (int, int, error) {
-	parts := strings.Split(strings.TrimSpace(value), ":")
-	if len(parts) == 0 || len(parts) > 2 {
-		return 0, 0, fmt.Errorf("rotate_at invalido")
-	}
-	hour, err := strconv.Atoi(parts[0])
-	if err != nil || hour < 0 || hour > 23 {
-		return 0, 0, fmt.Errorf("hora invalida")
+func rotateInterval(cfg config.Config) time.Duration {
+	if cfg.IntervalRotateSeconds > 0 {
+		return time.Duration(cfg.IntervalRotateSeconds) * time.Second
 	}
-	minute := 0
-	if len(parts) == 2 {
-		minute, err = strconv.Atoi(parts[1])
-		if err != nil || minute < 0 || minute > 59 {
-			return 0, 0, fmt.Errorf("minuto invalido")
-		}
-	}
-	return hour, minute, nil
+	return 300 * time.Second
 }
 
 func rotateCmd() {
@@ -309,7 +356,9 @@ func rotateCmd() {
 	}
 	defer st.Close()
 
-	if err := rotateAll(cfg, inputs, st, true); err != nil {
+	err = rotateAll(cfg, inputs, st, true)
+	reopens.wait(st)
+	if err != nil {
 		writeStatusSnapshot(cfg, inputs, st, err.Error())
 		log.Printf("erro na rotacao: %v", err)
 		os.Exit(1)
@@ -362,7 +411,7 @@ func statusCmd() {
 		defer st.Close()
 	}
 
-	payload := status.Build(cfg, inputs, st, "")
+	payload := status.Build(cfg, inputs, st, "", lastDiskUsage())
 	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "erro ao gerar status: %v\n", err)
@@ -371,6 +420,101 @@ func statusCmd() {
 	fmt.Println(string(data))
 }
 
+type archiveList struct {
+	Package  string               `json:"package"`
+	LogID    string               `json:"log_id"`
+	Path     string               `json:"path"`
+	Archives []rotate.Archive     `json:"archives"`
+	Catalog  []state.ArchiveEntry `json:"catalog,omitempty"`
+}
+
+// archivesCmd lista as geracoes de um log com o catalogo (intervalo de
+// timestamps, sha256, enviado) ou, com uma data, a geracao que contem aquele
+// instante: pelo catalogo quando alguma entrada cobre o instante, senao pelo
+// nome ou mtime.
+func archivesCmd(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: zid-logs archives <package> <log_id> [AAAA-MM-DD[THH:MM]]")
+		os.Exit(2)
+	}
+	var at time.Time
+	if len(args) > 2 {
+		var err error
+		at, err = parseArchiveDate(args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "data invalida: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	cfg, err := config.LoadConfig(config.DefaultConfigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro ao carregar configuracoes: %v\n", err)
+		os.Exit(1)
+	}
+	inputs, err := loadInputsSafe(config.DefaultInputsDir, cfg.Defaults)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro ao carregar inputs: %v\n", err)
+		os.Exit(1)
+	}
+	catalog := loadCatalog()
+
+	var out []archiveList
+	for _, input := range inputs {
+		if input.Package != args[0] || input.LogID != args[1] {
+			continue
+		}
+		policy := rotate.ResolvePolicy(cfg.Defaults, input.Policy)
+		item := archiveList{Package: input.Package, LogID: input.LogID, Path: input.Path}
+		entries := catalog[input.Path]
+		if at.IsZero() {
+			item.Archives, err = rotate.ListArchives(input.Path, policy)
+			item.Catalog = entries
+		} else if entry, ok := findCataloged(entries, at); ok {
+			item.Catalog = []state.ArchiveEntry{entry}
+			var archives []rotate.Archive
+			archives, err = rotate.ListArchives(input.Path, policy)
+			for _, archive := range archives {
+				if archive.Path == entry.File {
+					item.Archives = []rotate.Archive{archive}
+				}
+			}
+		} else {
+			var archive rotate.Archive
+			var ok bool
+			archive, ok, err = rotate.FindArchive(input.Path, policy, at)
+			if ok {
+				item.Archives = []rotate.Archive{archive}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro ao listar %s: %v\n", input.Path, err)
+			os.Exit(1)
+		}
+		out = append(out, item)
+	}
+	if len(out) == 0 {
+		fmt.Fprintf(os.Stderr, "log %s/%s nao registrado\n", args[0], args[1])
+		os.Exit(1)
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro ao gerar saida: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+func parseArchiveDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("use AAAA-MM-DD ou AAAA-MM-DDTHH:MM: %s", value)
+}
+
 func validateCmd() {
 	cfg, inputs, st, err := loadAll()
 	if err != nil {
@@ -387,10 +531,91 @@ func validateCmd() {
 		problems = append(problems, "auth_token nao configurado")
 	}
 
+	if err := shipper.ValidateCompression(cfg.Compression); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	for _, window := range cfg.ThrottleSchedule {
+		if _, err := throttle.ParseClock(window.Start); err != nil {
+			problems = append(problems, fmt.Sprintf("throttle_schedule: %v", err))
+		}
+		if _, err := throttle.ParseClock(window.End); err != nil {
+			problems = append(problems, fmt.Sprintf("throttle_schedule: %v", err))
+		}
+	}
+
+	if _, err := schedule.For(cfg, registry.LogInput{}); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if cfg.DiskBudget.MaxTotalMB < 0 || cfg.DiskBudget.MinFreeMB < 0 || cfg.DiskBudget.MinFreePercent < 0 || cfg.DiskBudget.MinFreePercent >= 100 {
+		problems = append(problems, "disk_budget invalido")
+	}
+	if err := validateNaming(cfg.Defaults.Naming, cfg.Defaults.DateFormat); err != nil {
+		problems = append(problems, "defaults: "+err.Error())
+	}
+	if err := rotate.ValidateMode(cfg.Defaults.RotateMode); err != nil {
+		problems = append(problems, "defaults: "+err.Error())
+	}
+	if err := rotate.ValidateCompressFormat(cfg.Defaults.CompressFormat, cfg.Defaults.CompressLevel); err != nil {
+		problems = append(problems, "defaults: "+err.Error())
+	}
+
 	for _, input := range inputs {
 		if input.Package == "" || input.LogID == "" || input.Path == "" {
 			problems = append(problems, fmt.Sprintf("input invalido em %s", input.Source))
 		}
+		switch registry.InputType(input) {
+		case registry.TypeExec:
+			if strings.TrimSpace(input.Command) == "" {
+				problems = append(problems, fmt.Sprintf("input exec sem command em %s", input.Source))
+			}
+		case registry.TypeFifo:
+			if input.FifoPath == "" {
+				problems = append(problems, fmt.Sprintf("input fifo sem fifo_path em %s", input.Source))
+			}
+		}
+		if _, err := shipper.ParseStartPosition(input.StartPosition); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		}
+		if _, err := timestamp.For(input); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		} else if err := shipper.ValidateCatchUp(input); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		}
+		if err := validateNaming(input.Policy.Naming, input.Policy.DateFormat); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		}
+		if err := rotate.ValidateMode(input.Policy.RotateMode); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		}
+		if err := hook.Validate(hook.PreRotate, input.PreRotate); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		}
+		if err := hook.Validate(hook.PostRotate, input.PostRotate); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		}
+		if match := processMatch(input); match != nil {
+			if _, err := proc.NewMatcher(*match); err != nil {
+				problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+			}
+		}
+		if input.Policy.CompressFormat != "" || input.Policy.CompressLevel != 0 {
+			format := input.Policy.CompressFormat
+			if format == "" {
+				format = cfg.Defaults.CompressFormat
+			}
+			if err := rotate.ValidateCompressFormat(format, input.Policy.CompressLevel); err != nil {
+				problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+			}
+		}
+		if input.RotateSchedule != "" || input.RotateTimezone != "" {
+			if _, err := schedule.For(cfg, input); err != nil {
+				problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+			}
+		}
+		if err := validateCutMode(cfg, input); err != nil {
+			problems = append(problems, fmt.Sprintf("%v em %s", err, input.Source))
+		}
 	}
 
 	if len(problems) > 0 {
@@ -402,6 +627,62 @@ func validateCmd() {
 	fmt.Println("ok")
 }
 
+func validateNaming(naming, dateFormat string) error {
+	switch naming {
+	case "", rotate.NamingNumeric, rotate.NamingDate:
+	default:
+		return fmt.Errorf("naming invalido: %s", naming)
+	}
+	return rotate.ValidateDateFormat(dateFormat)
+}
+
+// validateCutMode recusa copytruncate em inputs cortados por timestamp: o
+// log precisa manter o inode, entao o trecho depois do corte nao teria onde
+// ficar.
+func validateCutMode(cfg config.Config, input registry.LogInput) error {
+	if !rotationEnabled(input) || rotate.ResolvePolicy(cfg.Defaults, input.Policy).Mode != rotate.ModeCopyTruncate {
+		return nil
+	}
+	parser, err := timestamp.For(input)
+	if err != nil || parser == nil {
+		return nil
+	}
+	if sched, err := schedule.For(cfg, input); err != nil || sched == nil {
+		return nil
+	}
+	return errors.New("rotate_mode copytruncate nao aceita corte por timestamp (rotate_schedule com timestamp_layout/timestamp)")
+}
+
+// afterRotation atualiza o checkpoint apos uma rotacao. No copytruncate o log
+// mantem o inode mas recomeca vazio: o offset volta a 0 e o fingerprint e
+// recalculado pelo shipper sem que isso conte como truncamento. O que o envio
+// ainda nao tinha lido ficou so no arquivo rotacionado e vira um gap.
+func afterRotation(cp *state.Checkpoint, policy rotate.Policy, hooks *rotationHooks) {
+	now := time.Now()
+	cp.LastRotateAt = now.Unix()
+	if policy.Mode != rotate.ModeCopyTruncate {
+		return
+	}
+	if hooks.tracked && hooks.archived > hooks.shipped {
+		skipped := hooks.archived - hooks.shipped
+		addEvent(hooks.st, state.Event{
+			Kind:    "gap",
+			Package: cp.Package,
+			LogID:   cp.LogID,
+			Path:    cp.Path,
+			Detail: fmt.Sprintf("copytruncate: %d bytes nao enviados ficaram em %s, offset %d -> 0",
+				skipped, hooks.history.Archive, hooks.shipped),
+		})
+		cp.Gaps++
+		cp.GapBytes += skipped
+		cp.LastGapBytes = skipped
+		cp.LastGapAt = now.Unix()
+	}
+	cp.LastOffset = 0
+	cp.Identity.Fingerprint = ""
+	cp.Identity.FingerprintSize = 0
+}
+
 func loadAll() (config.Config, []registry.LogInput, *state.State, error) {
 	cfg, err := config.LoadConfig(config.DefaultConfigPath)
 	if err != nil {
@@ -412,7 +693,7 @@ func loadAll() (config.Config, []registry.LogInput, *state.State, error) {
 		return config.Config{}, nil, nil, err
 	}
 
-	inputs, err := loadInputsSafe(config.DefaultInputsDir)
+	inputs, err := loadInputsSafe(config.DefaultInputsDir, cfg.Defaults)
 	if err != nil {
 		return config.Config{}, nil, nil, err
 	}
@@ -438,7 +719,7 @@ func loadAllReadOnly() (config.Config, []registry.LogInput, *state.State, error)
 		return config.Config{}, nil, nil, err
 	}
 
-	inputs, err := loadInputsSafe(config.DefaultInputsDir)
+	inputs, err := loadInputsSafe(config.DefaultInputsDir, cfg.Defaults)
 	if err != nil {
 		return config.Config{}, nil, nil, err
 	}
@@ -463,7 +744,7 @@ func writeStatusSnapshot(cfg config.Config, inputs []registry.LogInput, st *stat
 	if st == nil {
 		return
 	}
-	payload := status.Build(cfg, inputs, st, lastError)
+	payload := status.Build(cfg, inputs, st, lastError, lastDiskUsage())
 	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		return
@@ -474,6 +755,19 @@ func writeStatusSnapshot(cfg config.Config, inputs []registry.LogInput, st *stat
 	_ = os.WriteFile(statusSnapshotPath, data, 0644)
 }
 
+// lastDiskUsage retorna a ultima medicao do disk_budget deste processo ou,
+// nos comandos avulsos, a do ultimo status salvo pelo daemon.
+func lastDiskUsage() *budget.Usage {
+	if diskUsage != nil {
+		return diskUsage
+	}
+	snapshot, ok, err := loadStatusSnapshot()
+	if err != nil || !ok {
+		return nil
+	}
+	return snapshot.DiskBudget
+}
+
 func loadStatusSnapshot() (status.Status, bool, error) {
 	data, err := os.ReadFile(statusSnapshotPath)
 	if err != nil {
@@ -489,27 +783,167 @@ func loadStatusSnapshot() (status.Status, bool, error) {
 	return payload, true, nil
 }
 
-func loadInputsSafe(dir string) ([]registry.LogInput, error) {
+func loadInputsSafe(dir string, defaults config.RotateDefaults) ([]registry.LogInput, error) {
 	if _, err := os.Stat(dir); err != nil {
 		if os.IsNotExist(err) {
 			return []registry.LogInput{}, nil
 		}
 		return nil, err
 	}
-	return registry.LoadInputs(dir)
+	inputs, err := registry.LoadInputs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return registry.ExpandInputs(inputs, defaults), nil
 }
 
-func refreshInputs(current []registry.LogInput) []registry.LogInput {
-	inputs, err := loadInputsSafe(config.DefaultInputsDir)
+func refreshInputs(current []registry.LogInput, cfg config.Config, st *state.State) []registry.LogInput {
+	inputs, err := loadInputsSafe(config.DefaultInputsDir, cfg.Defaults)
 	if err != nil {
 		return current
 	}
+	handleMissing(current, inputs, st)
 	return inputs
 }
 
+// handleMissing trata arquivos de inputs com glob que deixaram de existir:
+// o evento e sempre registrado e, com on_missing=forget, o checkpoint e
+// removido para que um arquivo novo com o mesmo nome comece do zero.
+func handleMissing(previous, current []registry.LogInput, st *state.State) {
+	if st == nil {
+		return
+	}
+	present := make(map[string]bool, len(current))
+	for _, input := range current {
+		present[inputKey(input)] = true
+	}
+	for _, input := range previous {
+		if input.Pattern == "" || present[inputKey(input)] {
+			continue
+		}
+		detail := "checkpoint mantido"
+		if strings.EqualFold(input.OnMissing, registry.OnMissingForget) {
+			if err := st.DeleteCheckpoint(input.Package, input.LogID, input.Path); err != nil {
+				log.Printf("erro ao remover checkpoint %s: %v", input.Path, err)
+			}
+			detail = "checkpoint removido"
+		}
+		log.Printf("arquivo ausente %s (%s): %s", input.Path, input.Pattern, detail)
+		_ = st.AddEvent(state.Event{
+			Kind:    "file_missing",
+			Package: input.Package,
+			LogID:   input.LogID,
+			Path:    input.Path,
+			Detail:  input.Pattern + ": " + detail,
+		})
+	}
+}
+
+func inputKey(input registry.LogInput) string {
+	return input.Package + "/" + input.LogID + "/" + input.Path
+}
+
+func rotationEnabled(input registry.LogInput) bool {
+	return input.Policy.RotateEnabled == nil || *input.Policy.RotateEnabled
+}
+
+// rotatePolicy resolve a policy do input ligada ao journal de rotacao do
+// state, ao compressor e aos hooks, que tambem montam o historico e o
+// catalogo.
+func rotatePolicy(cfg config.Config, input registry.LogInput, st *state.State) (rotate.Policy, *rotationHooks) {
+	policy := rotate.ResolvePolicy(cfg.Defaults, input.Policy)
+	if st != nil {
+		policy.Journal = st
+	}
+	policy.Compressor = compressor
+	hooks := &rotationHooks{input: input, st: st}
+	policy.Hooks = hooks
+	policy.Catalog = hooks
+	return policy, hooks
+}
+
+// recordCompression registra no state o resultado de uma compressao em
+// segundo plano (taxa e duracao).
+func recordCompression(st *state.State, inputs []registry.LogInput, result rotate.CompressResult) {
+	ev := state.Event{Kind: "compress", Path: result.Path}
+	for _, input := range inputs {
+		if input.Path == result.Path {
+			ev.Package, ev.LogID = input.Package, input.LogID
+			break
+		}
+	}
+	if result.Err != nil {
+		log.Printf("erro na compressao de %s: %v", result.Path, result.Err)
+		ev.Kind = "compress_error"
+		ev.Detail = result.Err.Error()
+	} else {
+		ev.Detail = fmt.Sprintf("%s %s: %d -> %d bytes (%.2fx) em %s",
+			filepath.Base(result.Archive), result.Format, result.RawBytes, result.Bytes, result.Ratio(), result.Duration.Round(time.Millisecond))
+	}
+	addEvent(st, ev)
+	if st != nil {
+		run := state.CompressionRun{
+			Archive:    result.Archive,
+			Format:     result.Format,
+			RawBytes:   result.RawBytes,
+			Bytes:      result.Bytes,
+			DurationMs: result.Duration.Milliseconds(),
+		}
+		if result.Err != nil {
+			run.Error = result.Err.Error()
+		}
+		_ = st.AddCompression(result.Path, run)
+		catalogCompressed(st, result)
+	}
+}
+
+// recoverRotations conclui ou desfaz as rotacoes que ficaram pela metade
+// (queda do daemon ou do equipamento) conforme o journal do state.
+func recoverRotations(cfg config.Config, inputs []registry.LogInput, st *state.State) {
+	if st == nil {
+		return
+	}
+	pending, err := st.ListRotations()
+	if err != nil {
+		log.Printf("erro ao ler journal de rotacao: %v", err)
+		return
+	}
+	for _, r := range pending {
+		input := registry.LogInput{Path: r.Path}
+		for _, candidate := range inputs {
+			if candidate.Path == r.Path {
+				input = candidate
+				break
+			}
+		}
+		policy := rotate.ResolvePolicy(cfg.Defaults, input.Policy)
+		policy.Catalog = &rotationHooks{input: input, st: st}
+		if err := rotate.Recover(r.Path, policy, r); err != nil {
+			log.Printf("erro ao recuperar rotacao de %s (%s): %v", r.Path, r.Step, err)
+			continue
+		}
+		_ = st.DeleteRotation(r.Path)
+		log.Printf("rotacao interrompida recuperada %s (passo %s)", r.Path, r.Step)
+		addEvent(st, state.Event{
+			Kind:    "rotation_recovered",
+			Package: input.Package,
+			LogID:   input.LogID,
+			Path:    r.Path,
+			Detail:  "passo " + r.Step,
+		})
+	}
+}
+
 func rotateAll(cfg config.Config, inputs []registry.LogInput, st *state.State, force bool) error {
 	for _, input := range inputs {
-		rotated, err := rotateOne(cfg, input, st, force)
+		if !rotationEnabled(input) {
+			continue
+		}
+		trigger := ""
+		if force {
+			trigger = rotate.TriggerForced
+		}
+		rotated, err := rotateOne(cfg, input, st, trigger)
 		if err != nil {
 			if os.IsNotExist(err) {
 				continue
@@ -523,15 +957,25 @@ func rotateAll(cfg config.Config, inputs []registry.LogInput, st *state.State, f
 	return nil
 }
 
-func rotateOne(cfg config.Config, input registry.LogInput, st *state.State, force bool) (bool, error) {
-	policy := rotate.ResolvePolicy(cfg.Defaults, input.Policy)
+// rotateOne rotaciona o input por tamanho/idade ou, com trigger, a forca
+// (forced, budget).
+func rotateOne(cfg config.Config, input registry.LogInput, st *state.State, trigger string) (bool, error) {
+	policy, hooks := rotatePolicy(cfg, input, st)
 	var rotated bool
 	var err error
-	if force {
+	if trigger != "" {
+		hooks.begin(trigger)
 		rotated, err = rotate.ForceRotate(input.Path, policy)
 	} else {
+		if info, statErr := os.Stat(input.Path); statErr == nil {
+			hooks.begin(rotate.Due(info, policy))
+		}
 		rotated, err = rotate.RotateIfNeeded(input.Path, policy)
 	}
+	hooks.finish(rotated, err)
+	if errors.Is(err, rotate.ErrVetoed) {
+		return false, vetoed(input, st, err)
+	}
 	if err != nil {
 		return false, err
 	}
@@ -545,59 +989,171 @@ func rotateOne(cfg config.Config, input registry.LogInput, st *state.State, forc
 					Path:    input.Path,
 				}
 			}
-			cp.LastRotateAt = time.Now().Unix()
+			afterRotation(&cp, policy, hooks)
 			_ = st.SaveCheckpoint(cp)
 		}
 	}
-	if rotated {
-		if err := notifyPostRotate(input); err != nil {
-			log.Printf("post-rotate falhou %s: %v", input.Path, err)
-		}
-	}
 	return rotated, nil
 }
 
-func rotateIfDue(cfg config.Config, inputs []registry.LogInput, st *state.State) {
-	if cfg.RotateAt == "" {
+// vetoed registra o veto do pre_rotate; a rotacao e tentada de novo no
+// proximo ciclo.
+func vetoed(input registry.LogInput, st *state.State, err error) error {
+	log.Printf("rotacao de %s adiada: %v", input.Path, err)
+	addEvent(st, state.Event{
+		Kind:    "rotate_vetoed",
+		Package: input.Package,
+		LogID:   input.LogID,
+		Path:    input.Path,
+		Detail:  err.Error(),
+	})
+	return nil
+}
+
+// enforceDiskBudget aplica disk_budget: quando o total passa de max_total_mb
+// ou o espaco livre cai abaixo do minimo, rotaciona antes da hora os logs
+// acima de max_size_mb e remove as geracoes mais antigas de todos os inputs.
+func enforceDiskBudget(cfg config.Config, inputs []registry.LogInput, st *state.State) {
+	if !budget.Enabled(cfg.DiskBudget) {
+		diskUsage = nil
 		return
 	}
-	hour, minute, err := parseRotateAt(cfg.RotateAt)
+	targets := budget.Targets(cfg, inputs)
+	for i := range targets {
+		targets[i].Policy, _ = rotatePolicy(cfg, targets[i].Input, st)
+	}
+	usage, err := budget.Measure(cfg.DiskBudget, targets)
 	if err != nil {
-		log.Printf("rotate_at invalido: %v", err)
+		log.Printf("erro ao medir disk_budget: %v", err)
 		return
 	}
-	now := time.Now()
-	scheduled := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
-	if now.Before(scheduled) {
+	if !usage.Over() {
+		diskUsage = &usage
+		return
+	}
+	for _, target := range budget.Oversized(targets) {
+		if !rotationEnabled(target.Input) {
+			continue
+		}
+		rotated, err := rotateOne(cfg, target.Input, st, rotate.TriggerBudget)
+		if err != nil {
+			log.Printf("erro na rotacao antecipada %s: %v", target.Input.Path, err)
+			continue
+		}
+		if rotated {
+			log.Printf("disk_budget: rotacao antecipada %s", target.Input.Path)
+			addEvent(st, state.Event{
+				Kind:    "budget_rotate",
+				Package: target.Input.Package,
+				LogID:   target.Input.LogID,
+				Path:    target.Input.Path,
+			})
+		}
+	}
+	if usage, err = budget.Measure(cfg.DiskBudget, targets); err != nil {
+		log.Printf("erro ao medir disk_budget: %v", err)
 		return
 	}
+	decisions, err := budget.Prune(usage)
+	pruned := usage.Pruned(decisions)
+	diskUsage = &pruned
+	for _, d := range decisions {
+		log.Printf("disk_budget: removido %s (%d bytes, %s)", d.Path, d.Bytes, d.Reason)
+		addEvent(st, state.Event{
+			Kind:    "budget_prune",
+			Package: d.Package,
+			LogID:   d.LogID,
+			Path:    d.Path,
+			Detail:  fmt.Sprintf("%s: %d bytes", d.Reason, d.Bytes),
+		})
+	}
+	if err != nil {
+		log.Printf("erro ao aplicar disk_budget: %v", err)
+	}
+}
+
+func addEvent(st *state.State, ev state.Event) {
+	if st != nil {
+		_ = st.AddEvent(ev)
+	}
+}
+
+// maxMissedRotations limita quantos periodos perdidos viram cortes separados;
+// os mais antigos ficam juntos no primeiro corte.
+const maxMissedRotations = 366
+
+// rotateIfDue rotaciona os inputs com agenda cujos disparos ainda nao foram
+// atendidos. Cada disparo perdido desde a ultima rotacao vira um corte
+// proprio, para que cada arquivo rotacionado contenha um unico periodo.
+func rotateIfDue(cfg config.Config, inputs []registry.LogInput, st *state.State) {
+	now := time.Now()
 	for _, input := range inputs {
-		var lastRotate int64
+		if !rotationEnabled(input) {
+			continue
+		}
+		sched, err := schedule.For(cfg, input)
+		if err != nil {
+			log.Printf("agenda de rotacao invalida %s: %v", input.Path, err)
+			continue
+		}
+		if sched == nil {
+			continue
+		}
+		var last int64
 		if st != nil {
 			cp, ok, err := st.GetCheckpoint(input.Package, input.LogID, input.Path)
 			if err == nil && ok {
-				lastRotate = cp.LastRotateAt
+				last = cp.LastRotateBoundary
+				if last == 0 {
+					last = cp.LastRotateAt
+				}
 			}
 		}
-		if lastRotate >= scheduled.Unix() {
+		due := dueBoundaries(sched, last, now)
+		if len(due) == 0 {
 			continue
 		}
 
-		rotated, err := rotateScheduled(cfg, input, st, scheduled)
+		rotated, err := rotateScheduled(cfg, input, st, due)
 		if err != nil {
 			log.Printf("erro na rotacao: %v", err)
 			continue
 		}
 		if rotated {
-			log.Printf("rotacao agendada %s", input.Path)
+			log.Printf("rotacao agendada %s (%d periodo(s))", input.Path, len(due))
+		}
+	}
+}
+
+// dueBoundaries retorna os disparos ainda nao atendidos ate now. Sem
+// rotacao anterior apenas o ultimo disparo conta.
+func dueBoundaries(sched *schedule.Schedule, last int64, now time.Time) []time.Time {
+	if last == 0 {
+		if prev := sched.Prev(now); !prev.IsZero() {
+			return []time.Time{prev}
 		}
+		return nil
 	}
+	return sched.Between(time.Unix(last, 0), now, maxMissedRotations)
 }
 
-func notifyPostRotate(input registry.LogInput) error {
+// unscheduledInputs retorna os inputs sem agenda, rotacionados apenas por
+// tamanho/idade a cada interval_rotate_seconds.
+func unscheduledInputs(cfg config.Config, inputs []registry.LogInput) []registry.LogInput {
+	var out []registry.LogInput
+	for _, input := range inputs {
+		if sched, err := schedule.For(cfg, input); err == nil && sched == nil {
+			out = append(out, input)
+		}
+	}
+	return out
+}
+
+// signalPostRotate envia post_rotate_signal ao programa do log; com
+// post_rotate_command (legado) o comando substitui o sinal.
+func signalPostRotate(input registry.LogInput) error {
 	if input.PostRotateCommand != "" {
-		cmd := exec.Command("/bin/sh", "-c", input.PostRotateCommand)
-		return cmd.Run()
+		return nil
 	}
 	if input.PostRotatePidfile != "" {
 		pidData, err := os.ReadFile(input.PostRotatePidfile)
@@ -615,9 +1171,25 @@ func notifyPostRotate(input registry.LogInput) error {
 		signal := resolveSignal(input.PostRotateSignal)
 		return syscall.Kill(pid, signal)
 	}
+	if match := processMatch(input); match != nil {
+		matcher, err := proc.NewMatcher(*match)
+		if err != nil {
+			return err
+		}
+		_, err = proc.Signal(proc.NewLister(), matcher, resolveSignal(input.PostRotateSignal))
+		return err
+	}
+	return nil
+}
+
+// processMatch junta post_rotate_process e o post_rotate_match legado (regex
+// sobre a linha de comando, como o pgrep -f).
+func processMatch(input registry.LogInput) *registry.ProcessMatch {
+	if input.PostRotateProcess != nil {
+		return input.PostRotateProcess
+	}
 	if input.PostRotateMatch != "" {
-		signal := resolveSignal(input.PostRotateSignal)
-		return signalByMatch(input.PostRotateMatch, signal)
+		return &registry.ProcessMatch{ArgsRegex: input.PostRotateMatch}
 	}
 	return nil
 }
@@ -636,57 +1208,70 @@ func resolveSignal(name string) syscall.Signal {
 	return syscall.SIGHUP
 }
 
-func signalByMatch(match string, sig syscall.Signal) error {
-	out, err := exec.Command("/usr/bin/pgrep", "-f", match).Output()
+func rotateScheduled(cfg config.Config, input registry.LogInput, st *state.State, boundaries []time.Time) (bool, error) {
+	policy, hooks := rotatePolicy(cfg, input, st)
+	parser, err := timestamp.For(input)
 	if err != nil {
-		return err
-	}
-	pids := strings.Fields(string(out))
-	if len(pids) == 0 {
-		return fmt.Errorf("nenhum pid encontrado")
+		return false, err
 	}
-	for _, pidStr := range pids {
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
-			continue
+	var rotated bool
+	// copytruncate nao corta por timestamp (validate recusa): o arquivo
+	// inteiro e rotacionado no ultimo disparo
+	if parser == nil || policy.Mode == rotate.ModeCopyTruncate {
+		hooks.begin(rotate.TriggerSchedule)
+		rotated, err = rotate.ForceRotate(input.Path, policy)
+		hooks.finish(rotated, err)
+		if errors.Is(err, rotate.ErrVetoed) {
+			return false, vetoed(input, st, err)
+		}
+		if err == nil {
+			err = markRotated(input, st, policy, hooks, boundaries[len(boundaries)-1], rotated)
+		}
+		return rotated, err
+	}
+	// Um veto interrompe os cortes; os periodos restantes ficam para o
+	// proximo ciclo.
+	for _, boundary := range boundaries {
+		hooks.begin(rotate.TriggerSchedule)
+		cut, cutErr := rotate.RotateByTimestampCut(input.Path, policy, parser, boundary)
+		hooks.finish(cut, cutErr)
+		if errors.Is(cutErr, rotate.ErrVetoed) {
+			return rotated, vetoed(input, st, cutErr)
+		}
+		if cutErr != nil {
+			err = cutErr
+			break
+		}
+		rotated = rotated || cut
+		if err = markRotated(input, st, policy, hooks, boundary, cut); err != nil {
+			break
 		}
-		_ = syscall.Kill(pid, sig)
 	}
-	return nil
+	return rotated, err
 }
 
-func rotateScheduled(cfg config.Config, input registry.LogInput, st *state.State, scheduled time.Time) (bool, error) {
-	policy := rotate.ResolvePolicy(cfg.Defaults, input.Policy)
-	var rotated bool
-	var err error
-	if input.TimestampLayout != "" {
-		rotated, err = rotate.RotateByTimestampCut(input.Path, policy, input.TimestampLayout, scheduled)
-	} else {
-		rotated, err = rotate.ForceRotate(input.Path, policy)
+// markRotated registra o disparo atendido, mesmo quando o periodo estava
+// vazio e nada foi cortado.
+func markRotated(input registry.LogInput, st *state.State, policy rotate.Policy, hooks *rotationHooks, boundary time.Time, rotated bool) error {
+	if st == nil {
+		return nil
 	}
+	cp, ok, err := st.GetCheckpoint(input.Package, input.LogID, input.Path)
 	if err != nil {
-		return false, err
+		return err
 	}
-	if rotated && st != nil {
-		cp, ok, err := st.GetCheckpoint(input.Package, input.LogID, input.Path)
-		if err == nil {
-			if !ok {
-				cp = state.Checkpoint{
-					Package: input.Package,
-					LogID:   input.LogID,
-					Path:    input.Path,
-				}
-			}
-			cp.LastRotateAt = time.Now().Unix()
-			_ = st.SaveCheckpoint(cp)
+	if !ok {
+		cp = state.Checkpoint{
+			Package: input.Package,
+			LogID:   input.LogID,
+			Path:    input.Path,
 		}
 	}
+	cp.LastRotateBoundary = boundary.Unix()
 	if rotated {
-		if err := notifyPostRotate(input); err != nil {
-			log.Printf("post-rotate falhou %s: %v", input.Path, err)
-		}
+		afterRotation(&cp, policy, hooks)
 	}
-	return rotated, nil
+	return st.SaveCheckpoint(cp)
 }
 
 func shipAll(ctx context.Context, cfg config.Config, inputs []registry.LogInput, st *state.State) error {
@@ -710,6 +1295,110 @@ func shipAll(ctx context.Context, cfg config.Config, inputs []registry.LogInput,
 	return nil
 }
 
+func startIngest(cfg config.Config) *ingest.Server {
+	if !cfg.Ingest.Enabled {
+		return nil
+	}
+	srv, err := ingest.Start(cfg.Ingest, config.DefaultInputsDir)
+	if err != nil {
+		log.Printf("erro ao iniciar ingest em %s: %v", cfg.Ingest.Socket, err)
+		return nil
+	}
+	log.Printf("ingest ouvindo em %s", cfg.Ingest.Socket)
+	return srv
+}
+
+func stopIngest(srv *ingest.Server) {
+	if srv == nil {
+		return
+	}
+	if err := srv.Close(); err != nil {
+		log.Printf("erro ao encerrar ingest: %v", err)
+	}
+}
+
+const maxStreamBatches = 16
+
+func updateStreamer(streamer *stream.Streamer, inputs []registry.LogInput) {
+	if err := streamer.Update(inputs); err != nil {
+		log.Printf("erro ao observar inputs em stream: %v", err)
+	}
+}
+
+// shipStreams envia os inputs em modo stream que atingiram o limite de
+// linhas, bytes ou tempo. Em caso de erro o caminho deixa de ficar pendente
+// e volta a ser enviado na proxima escrita ou no ciclo normal de envio.
+func shipStreams(ctx context.Context, cfg config.Config, inputs []registry.LogInput, st *state.State, streamer *stream.Streamer) (bool, error) {
+	dirty := streamer.Dirty()
+	if os.Getenv("ZID_LOGS_DRY_RUN") == "1" {
+		for path := range dirty {
+			streamer.Clear(path)
+		}
+		return false, nil
+	}
+
+	now := time.Now()
+	shipped := false
+	var firstErr error
+	for path, since := range dirty {
+		done := true
+		for _, input := range inputs {
+			if input.Path != path || !stream.IsStream(input) {
+				continue
+			}
+			if input.Policy.ShipEnabled != nil && !*input.Policy.ShipEnabled {
+				continue
+			}
+			th := stream.Resolve(input, cfg)
+			pending, lines, err := shipper.Pending(input, st, th.MaxBytes)
+			if err != nil {
+				if !os.IsNotExist(err) && firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if !stream.Due(th, pending, lines, since, now) {
+				if pending > 0 {
+					done = false
+				}
+				continue
+			}
+			left, err := drainInput(ctx, th.Batch(cfg), input, st)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			shipped = true
+			if left > 0 {
+				done = false
+			}
+		}
+		if done {
+			streamer.Clear(path)
+		}
+	}
+	return shipped, firstErr
+}
+
+func drainInput(ctx context.Context, cfg config.Config, input registry.LogInput, st *state.State) (int64, error) {
+	for i := 0; i < maxStreamBatches; i++ {
+		if _, err := shipper.ShipOnce(ctx, input, cfg, st); err != nil {
+			return 0, err
+		}
+		left, _, err := shipper.Pending(input, st, 1)
+		if err != nil {
+			return 0, err
+		}
+		if left == 0 {
+			return 0, nil
+		}
+	}
+	left, _, err := shipper.Pending(input, st, 1)
+	return left, err
+}
+
 type logFile struct {
 	file *os.File
 }
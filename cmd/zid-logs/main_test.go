@@ -0,0 +1,200 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/managed"
+	"zid-logs/internal/registry"
+	"zid-logs/internal/rotate"
+	"zid-logs/internal/shipper"
+	"zid-logs/internal/state"
+	"zid-logs/internal/stream"
+	"zid-logs/internal/watch"
+)
+
+func TestReopenWarningWhenWriterKeepsOldFile(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Open(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer st.Close()
+	defer reopens.stop()
+
+	path := filepath.Join(dir, "app.log")
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("OpenFile error: %v", err)
+	}
+	defer writer.Close()
+	if _, err := writer.WriteString("antes\n"); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	input := registry.LogInput{
+		Package:    "zid-proxy",
+		LogID:      "main",
+		Path:       path,
+		PostRotate: &registry.HookConfig{Command: "true"},
+	}
+	rotated, err := rotateOne(cfg, input, st, rotate.TriggerForced)
+	if err != nil || !rotated {
+		t.Fatalf("rotateOne = %v, %v", rotated, err)
+	}
+
+	if _, err := writer.WriteString("depois\n"); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	reopens.run(st, time.Now().Add(reopenCheckDelay))
+
+	events, err := st.ListEvents(0)
+	if err != nil {
+		t.Fatalf("ListEvents error: %v", err)
+	}
+	for _, ev := range events {
+		if ev.Kind == "reopen_warning" && ev.Path == path {
+			return
+		}
+	}
+	t.Fatalf("expected reopen_warning, got %+v", events)
+}
+
+func TestManagedWriterKeepsLinesAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Open(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer st.Close()
+
+	path := filepath.Join(dir, "ingest.log")
+	w := managed.NewWriter(path)
+	const total = 600
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < total; i++ {
+			if _, err := fmt.Fprintf(w, "linha %d\n", i); err != nil {
+				done <- err
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		done <- nil
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cfg := config.DefaultConfig()
+	compress := false
+	cfg.Defaults.Compress = &compress
+	input := registry.LogInput{Package: "ingest", LogID: "main", Path: path}
+	rotated, err := rotateOne(cfg, input, st, rotate.TriggerForced)
+	if err != nil || !rotated {
+		t.Fatalf("rotateOne = %v, %v", rotated, err)
+	}
+	rotatedSize := fileSize(t, path+".1")
+	if err := <-done; err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	w.Close()
+
+	// o que cai no arquivo ja rotacionado nunca e enviado
+	if size := fileSize(t, path+".1"); size != rotatedSize {
+		t.Fatalf("archive grew after rotation: %d -> %d", rotatedSize, size)
+	}
+	live, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read live: %v", err)
+	}
+	archive, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if got := strings.Count(string(archive)+string(live), "\n"); got != total {
+		t.Fatalf("expected %d lines across rotation, got %d", total, got)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	return info.Size()
+}
+
+func TestStreamBurstIsSplitByMaxBytes(t *testing.T) {
+	var batches []shipper.Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		var payload shipper.Payload
+		_ = json.NewDecoder(gz).Decode(&payload)
+		batches = append(batches, payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	st, err := state.Open(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer st.Close()
+
+	path := filepath.Join(dir, "events.log")
+	var burst strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&burst, "evento %012d\n", i)
+	}
+	if err := os.WriteFile(path, []byte(burst.String()), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cfg := config.Config{Endpoint: server.URL, ShipFormat: "lines", MaxBytesPerShip: 64 * 1024}
+	input := registry.LogInput{
+		Package: "zid-proxy",
+		LogID:   "events",
+		Path:    path,
+		Mode:    stream.ModeStream,
+		Stream:  registry.StreamPolicy{MaxBytes: 200},
+	}
+	streamer := stream.Start(watch.New())
+	defer streamer.Stop()
+	if err := streamer.Update([]registry.LogInput{input}); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+
+	if _, err := shipStreams(context.Background(), cfg, []registry.LogInput{input}, st, streamer); err != nil {
+		t.Fatalf("shipStreams error: %v", err)
+	}
+	if len(batches) != burst.Len()/200 {
+		t.Fatalf("expected %d batches, got %d", burst.Len()/200, len(batches))
+	}
+	lines := 0
+	for _, batch := range batches {
+		if batch.OffsetEnd-batch.OffsetStart > 200 {
+			t.Fatalf("batch over stream max_bytes: %d -> %d", batch.OffsetStart, batch.OffsetEnd)
+		}
+		lines += len(batch.Lines)
+	}
+	if lines != 50 {
+		t.Fatalf("expected 50 lines, got %d", lines)
+	}
+}
@@ -3,8 +3,9 @@ module zid-logs
 go 1.22
 
 require (
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
 	go.etcd.io/bbolt v1.3.11
 	golang.org/x/crypto v0.24.0
+	golang.org/x/sys v0.21.0
 )
-
-require golang.org/x/sys v0.21.0 // indirect
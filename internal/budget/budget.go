@@ -0,0 +1,253 @@
+package budget
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/registry"
+	"zid-logs/internal/rotate"
+)
+
+const mb = 1024 * 1024
+
+// Target e um log gerenciado com a policy de rotacao ja resolvida.
+type Target struct {
+	Input  registry.LogInput
+	Policy rotate.Policy
+}
+
+// Usage resume o espaco ocupado pelos logs e o espaco livre no sistema de
+// arquivos mais apertado.
+type Usage struct {
+	MaxTotalMB     int     `json:"max_total_mb"`
+	MinFreeMB      int     `json:"min_free_mb"`
+	MinFreePercent float64 `json:"min_free_percent"`
+	UsedBytes      int64   `json:"used_bytes"`
+	LiveBytes      int64   `json:"live_bytes"`
+	ArchiveBytes   int64   `json:"archive_bytes"`
+	FreeBytes      int64   `json:"free_bytes"`
+	OverTotal      bool    `json:"over_total"`
+	BelowFree      bool    `json:"below_free"`
+	MeasuredAt     int64   `json:"measured_at"`
+
+	filesystems map[uint64]*filesystem
+	archives    []candidate
+}
+
+func (u Usage) Over() bool {
+	return u.OverTotal || u.BelowFree
+}
+
+// Decision registra a remocao de um arquivo rotacionado pelo orcamento.
+type Decision struct {
+	Package string
+	LogID   string
+	Path    string
+	Bytes   int64
+	Reason  string
+}
+
+type filesystem struct {
+	free    int64
+	minFree int64
+}
+
+type candidate struct {
+	target  Target
+	archive rotate.Archive
+	dev     uint64
+	newest  bool
+}
+
+func Enabled(cfg config.DiskBudgetConfig) bool {
+	return cfg.MaxTotalMB > 0 || cfg.MinFreeMB > 0 || cfg.MinFreePercent > 0
+}
+
+func Targets(cfg config.Config, inputs []registry.LogInput) []Target {
+	targets := make([]Target, 0, len(inputs))
+	for _, input := range inputs {
+		targets = append(targets, Target{Input: input, Policy: rotate.ResolvePolicy(cfg.Defaults, input.Policy)})
+	}
+	return targets
+}
+
+// Measure soma os logs vivos e as geracoes de todos os inputs e consulta o
+// espaco livre de cada sistema de arquivos envolvido.
+func Measure(cfg config.DiskBudgetConfig, targets []Target) (Usage, error) {
+	usage := Usage{
+		MaxTotalMB:     cfg.MaxTotalMB,
+		MinFreeMB:      cfg.MinFreeMB,
+		MinFreePercent: cfg.MinFreePercent,
+		MeasuredAt:     time.Now().Unix(),
+		filesystems:    make(map[uint64]*filesystem),
+	}
+	for _, target := range targets {
+		if info, err := os.Stat(target.Input.Path); err == nil {
+			usage.LiveBytes += info.Size()
+			if err := usage.addFilesystem(cfg, filepath.Dir(target.Input.Path)); err != nil {
+				return usage, err
+			}
+		}
+		archives, err := rotate.ListArchives(target.Input.Path, target.Policy)
+		if err != nil {
+			return usage, err
+		}
+		for i, archive := range archives {
+			usage.ArchiveBytes += archive.Size
+			dir := filepath.Dir(archive.Path)
+			if err := usage.addFilesystem(cfg, dir); err != nil {
+				return usage, err
+			}
+			usage.archives = append(usage.archives, candidate{
+				target:  target,
+				archive: archive,
+				dev:     deviceOf(dir),
+				newest:  i == 0,
+			})
+		}
+	}
+	usage.summarize()
+	return usage, nil
+}
+
+// Pruned retorna o uso depois das remocoes de Prune, sem medir de novo.
+func (u Usage) Pruned(decisions []Decision) Usage {
+	for _, d := range decisions {
+		u.ArchiveBytes -= d.Bytes
+	}
+	u.summarize()
+	return u
+}
+
+func (u *Usage) summarize() {
+	u.UsedBytes = u.LiveBytes + u.ArchiveBytes
+	u.OverTotal = u.MaxTotalMB > 0 && u.UsedBytes > int64(u.MaxTotalMB)*mb
+	u.FreeBytes = -1
+	u.BelowFree = false
+	for _, fs := range u.filesystems {
+		if u.FreeBytes < 0 || fs.free < u.FreeBytes {
+			u.FreeBytes = fs.free
+		}
+		if fs.free < fs.minFree {
+			u.BelowFree = true
+		}
+	}
+	if u.FreeBytes < 0 {
+		u.FreeBytes = 0
+	}
+}
+
+func (u *Usage) addFilesystem(cfg config.DiskBudgetConfig, dir string) error {
+	dev := deviceOf(dir)
+	if _, ok := u.filesystems[dev]; ok {
+		return nil
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	free := int64(uint64(st.Bavail) * uint64(st.Bsize))
+	size := int64(uint64(st.Blocks) * uint64(st.Bsize))
+	minFree := int64(cfg.MinFreeMB) * mb
+	if byPercent := int64(float64(size) * cfg.MinFreePercent / 100); byPercent > minFree {
+		minFree = byPercent
+	}
+	u.filesystems[dev] = &filesystem{free: free, minFree: minFree}
+	return nil
+}
+
+func deviceOf(dir string) uint64 {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+	return 0
+}
+
+// Oversized retorna os logs vivos maiores que o max_size_mb da policy, que
+// devem ser rotacionados antes da hora quando o orcamento estoura.
+func Oversized(targets []Target) []Target {
+	var out []Target
+	for _, target := range targets {
+		if target.Policy.MaxSizeMB <= 0 {
+			continue
+		}
+		info, err := os.Stat(target.Input.Path)
+		if err != nil {
+			continue
+		}
+		if info.Size() >= int64(target.Policy.MaxSizeMB)*mb {
+			out = append(out, target)
+		}
+	}
+	return out
+}
+
+// Prune remove geracoes ate voltar ao orcamento. Ordem: primeiro as que nao
+// sao a geracao mais nova do seu input, depois menor prune_priority e por fim
+// as mais antigas. Inputs com legal_hold nunca perdem arquivos. A remocao
+// passa por rotate.RemoveArchive, com o Compressor e o Catalog da policy.
+func Prune(usage Usage) ([]Decision, error) {
+	if !usage.Over() {
+		return nil, nil
+	}
+	candidates := append([]candidate(nil), usage.archives...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.newest != b.newest {
+			return !a.newest
+		}
+		pa, pb := a.target.Input.Policy.PrunePriority, b.target.Input.Policy.PrunePriority
+		if pa != pb {
+			return pa < pb
+		}
+		return a.archive.Time.Before(b.archive.Time)
+	})
+
+	excess := int64(0)
+	if usage.MaxTotalMB > 0 {
+		excess = usage.UsedBytes - int64(usage.MaxTotalMB)*mb
+	}
+	var decisions []Decision
+	for _, c := range candidates {
+		if c.target.Policy.LegalHold {
+			continue
+		}
+		fs := usage.filesystems[c.dev]
+		short := fs != nil && fs.free < fs.minFree
+		if excess <= 0 && !short {
+			continue
+		}
+		file, size, ok, err := rotate.RemoveArchive(c.target.Input.Path, c.target.Policy, c.archive.Path)
+		if err != nil {
+			return decisions, err
+		}
+		if !ok {
+			continue
+		}
+		reason := "max_total_mb"
+		if short {
+			reason = "min_free"
+		}
+		decisions = append(decisions, Decision{
+			Package: c.target.Input.Package,
+			LogID:   c.target.Input.LogID,
+			Path:    file,
+			Bytes:   size,
+			Reason:  reason,
+		})
+		excess -= size
+		if fs != nil {
+			fs.free += size
+		}
+	}
+	return decisions, nil
+}
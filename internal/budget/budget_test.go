@@ -0,0 +1,105 @@
+package budget
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/registry"
+	"zid-logs/internal/rotate"
+)
+
+func writeSized(t *testing.T, path string, size int, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0640); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+func TestPruneOldestByPriority(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	policy := rotate.Policy{Keep: 5}
+
+	app := filepath.Join(dir, "app.log")
+	audit := filepath.Join(dir, "audit.log")
+	writeSized(t, app, 100*1024, now)
+	writeSized(t, audit, 100*1024, now)
+	for i := 1; i <= 3; i++ {
+		age := time.Duration(i) * time.Hour
+		writeSized(t, fmt.Sprintf("%s.%d", app, i), 300*1024, now.Add(-age))
+		writeSized(t, fmt.Sprintf("%s.%d", audit, i), 300*1024, now.Add(-age-30*time.Minute))
+	}
+
+	targets := []Target{
+		{Input: registry.LogInput{Package: "p", LogID: "app", Path: app}, Policy: policy},
+		{Input: registry.LogInput{Package: "p", LogID: "audit", Path: audit, Policy: registry.InputPolicy{PrunePriority: 10}}, Policy: policy},
+	}
+	// 200KB vivos + 1800KB de arquivos; limite de 1MB exige remover ~1000KB.
+	cfg := config.DiskBudgetConfig{MaxTotalMB: 1}
+	usage, err := Measure(cfg, targets)
+	if err != nil {
+		t.Fatalf("measure: %v", err)
+	}
+	if !usage.OverTotal || usage.UsedBytes != 2000*1024 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	decisions, err := Prune(usage)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	var removed []string
+	for _, d := range decisions {
+		removed = append(removed, filepath.Base(d.Path))
+		if d.Reason != "max_total_mb" {
+			t.Fatalf("unexpected reason %q", d.Reason)
+		}
+	}
+	want := []string{"app.log.3", "app.log.2", "audit.log.3", "audit.log.2"}
+	if strings.Join(removed, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, removed)
+	}
+	for _, keep := range []string{app + ".1", audit + ".1"} {
+		if _, err := os.Stat(keep); err != nil {
+			t.Fatalf("expected newest archive %s kept: %v", keep, err)
+		}
+	}
+
+	after, err := Measure(cfg, targets)
+	if err != nil {
+		t.Fatalf("measure: %v", err)
+	}
+	if after.Over() {
+		t.Fatalf("expected within budget, got %+v", after)
+	}
+	if pruned := usage.Pruned(decisions); pruned.UsedBytes != after.UsedBytes || pruned.Over() {
+		t.Fatalf("expected pruned usage like a new measure, got %+v want %+v", pruned, after)
+	}
+}
+
+func TestOversizedAndDisabled(t *testing.T) {
+	if Enabled(config.DiskBudgetConfig{}) {
+		t.Fatalf("expected disabled budget")
+	}
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.log")
+	small := filepath.Join(dir, "small.log")
+	writeSized(t, big, 1024*1024, time.Now())
+	writeSized(t, small, 10, time.Now())
+	targets := []Target{
+		{Input: registry.LogInput{Path: big}, Policy: rotate.Policy{MaxSizeMB: 1, Keep: 1}},
+		{Input: registry.LogInput{Path: small}, Policy: rotate.Policy{MaxSizeMB: 1, Keep: 1}},
+	}
+	got := Oversized(targets)
+	if len(got) != 1 || got[0].Input.Path != big {
+		t.Fatalf("expected only big.log oversized, got %+v", got)
+	}
+}
@@ -0,0 +1,238 @@
+package collect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"zid-logs/internal/managed"
+	"zid-logs/internal/registry"
+)
+
+const (
+	defaultExecInterval = 60 * time.Second
+	defaultExecTimeout  = 30 * time.Second
+	fifoRetryDelay      = 5 * time.Second
+)
+
+type runner struct {
+	input  registry.LogInput
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Manager mantem um coletor por input exec/fifo, gravando no arquivo buffer
+// do input; rotacao e envio seguem o fluxo normal de arquivos.
+type Manager struct {
+	mu      sync.Mutex
+	runners map[string]*runner
+}
+
+func NewManager() *Manager {
+	return &Manager{runners: make(map[string]*runner)}
+}
+
+func (m *Manager) Update(inputs []registry.LogInput) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]registry.LogInput)
+	for _, input := range inputs {
+		if registry.InputType(input) == registry.TypeFile {
+			continue
+		}
+		wanted[runnerKey(input)] = input
+	}
+
+	for key, r := range m.runners {
+		input, ok := wanted[key]
+		if ok && sameRunner(r.input, input) {
+			continue
+		}
+		r.stop()
+		delete(m.runners, key)
+	}
+	for key, input := range wanted {
+		if _, ok := m.runners[key]; ok {
+			continue
+		}
+		m.runners[key] = start(input)
+	}
+}
+
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, r := range m.runners {
+		r.stop()
+		delete(m.runners, key)
+	}
+}
+
+func start(input registry.LogInput) *runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &runner{input: input, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		w := managed.NewWriter(input.Path)
+		defer w.Close()
+		switch registry.InputType(input) {
+		case registry.TypeExec:
+			runExec(ctx, input, w)
+		case registry.TypeFifo:
+			runFifo(ctx, input, w)
+		}
+	}()
+	return r
+}
+
+func (r *runner) stop() {
+	r.cancel()
+	<-r.done
+}
+
+func runExec(ctx context.Context, input registry.LogInput, w *managed.Writer) {
+	interval := time.Duration(input.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultExecInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := ExecOnce(ctx, input, w, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("exec %s/%s falhou: %v", input.Package, input.LogID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExecOnce executa o comando do input e grava cada linha do stdout com o
+// timestamp da coleta (layout registry.ExecTimestampLayout).
+func ExecOnce(ctx context.Context, input registry.LogInput, w *managed.Writer, now time.Time) error {
+	if strings.TrimSpace(input.Command) == "" {
+		return errors.New("command vazio")
+	}
+	timeout := time.Duration(input.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, "/bin/sh", "-c", input.Command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	prefix := now.Format(registry.ExecTimestampLayout) + " "
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		out.WriteString(prefix)
+		out.Write(scanner.Bytes())
+		out.WriteByte('\n')
+	}
+	if out.Len() > 0 {
+		if _, err := w.Write(out.Bytes()); err != nil {
+			return err
+		}
+	}
+	if runErr != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", runErr, msg)
+		}
+		return runErr
+	}
+	return nil
+}
+
+func runFifo(ctx context.Context, input registry.LogInput, w *managed.Writer) {
+	for {
+		err := readFifo(ctx, input.FifoPath, w)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("fifo %s falhou: %v", input.FifoPath, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(fifoRetryDelay):
+		}
+	}
+}
+
+// readFifo abre o pipe em O_RDWR para nao receber EOF quando o ultimo
+// escritor fecha, e copia apenas linhas completas para o arquivo buffer.
+func readFifo(ctx context.Context, path string, w *managed.Writer) error {
+	if path == "" {
+		return errors.New("fifo_path vazio")
+	}
+	if err := ensureFifo(path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = file.Close() })
+	defer func() {
+		if stop() {
+			_ = file.Close()
+		}
+	}()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+}
+
+func ensureFifo(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s existe e nao e um fifo", path)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	return syscall.Mkfifo(path, 0660)
+}
+
+func runnerKey(input registry.LogInput) string {
+	return input.Package + "/" + input.LogID
+}
+
+func sameRunner(a, b registry.LogInput) bool {
+	return a.Type == b.Type && a.Path == b.Path && a.Command == b.Command &&
+		a.IntervalSeconds == b.IntervalSeconds && a.TimeoutSeconds == b.TimeoutSeconds &&
+		a.FifoPath == b.FifoPath
+}
@@ -0,0 +1,86 @@
+package collect
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zid-logs/internal/managed"
+	"zid-logs/internal/registry"
+)
+
+func TestExecOnceWritesTimestampedLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pfctl.log")
+	w := managed.NewWriter(path)
+	defer w.Close()
+
+	input := registry.LogInput{Package: "zid-fw", LogID: "pfctl", Type: "exec", Command: "printf 'states 10\\nsearches 20\\n'"}
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	if err := ExecOnce(context.Background(), input, w, now); err != nil {
+		t.Fatalf("ExecOnce error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	want := "2026-10-17T10:00:00Z states 10\n2026-10-17T10:00:00Z searches 20\n"
+	if string(data) != want {
+		t.Fatalf("unexpected output %q", data)
+	}
+
+	input.Command = "echo boom >&2; exit 3"
+	if err := ExecOnce(context.Background(), input, w, now); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected error with stderr, got %v", err)
+	}
+}
+
+func TestManagerReadsFifo(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "legacy.pipe")
+	path := filepath.Join(dir, "legacy.log")
+
+	m := NewManager()
+	defer m.Stop()
+	m.Update([]registry.LogInput{{Package: "legacy", LogID: "main", Type: "fifo", FifoPath: fifo, Path: path}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if info, err := os.Stat(fifo); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("fifo not created")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	writer, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open fifo: %v", err)
+	}
+	if _, err := writer.WriteString("one\ntwo\n"); err != nil {
+		t.Fatalf("write fifo: %v", err)
+	}
+	writer.Close()
+
+	for {
+		data, _ := os.ReadFile(path)
+		if string(data) == "one\ntwo\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected buffer content %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m.Update(nil)
+	if len(m.runners) != 0 {
+		t.Fatalf("expected runner stopped")
+	}
+}
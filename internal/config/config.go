@@ -5,37 +5,112 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 const (
-	DefaultConfigPath = "/usr/local/etc/zid-logs/config.json"
-	DefaultInputsDir  = "/var/db/zid-logs/inputs.d"
-	DeviceIDPath      = "/var/db/zid-logs/device_id"
-	StateDBPath       = "/var/db/zid-logs/state.db"
+	DefaultConfigPath   = "/usr/local/etc/zid-logs/config.json"
+	DefaultInputsDir    = "/var/db/zid-logs/inputs.d"
+	DeviceIDPath        = "/var/db/zid-logs/device_id"
+	StateDBPath         = "/var/db/zid-logs/state.db"
+	DefaultIngestSocket = "/var/run/zid-logs.sock"
+	DefaultManagedDir   = "/var/log/zid-logs"
 )
 
 type RotateDefaults struct {
-	MaxSizeMB     int   `json:"max_size_mb"`
-	Keep          int   `json:"keep"`
-	Compress      *bool `json:"compress"`
-	RotateOnStart bool  `json:"rotate_on_start"`
+	MaxSizeMB         int    `json:"max_size_mb"`
+	Keep              int    `json:"keep"`
+	Compress          *bool  `json:"compress"`
+	RotateOnStart     bool   `json:"rotate_on_start"`
+	Naming            string `json:"naming,omitempty"`
+	DateFormat        string `json:"date_format,omitempty"`
+	MaxArchiveAgeDays int    `json:"archive_max_age_days,omitempty"`
+	ArchiveDir        string `json:"archive_dir,omitempty"`
+	MaxArchiveTotalMB int    `json:"archive_max_total_mb,omitempty"`
+	RotateMode        string `json:"rotate_mode,omitempty"`
+	CompressFormat    string `json:"compress_format,omitempty"`
+	CompressLevel     int    `json:"compress_level,omitempty"`
+	DelayCompress     *bool  `json:"delay_compress,omitempty"`
+}
+
+const (
+	CompressionGzip    = "gzip"
+	CompressionZstd    = "zstd"
+	CompressionDeflate = "deflate"
+	CompressionNone    = "none"
+	CompressionXz      = "xz"
+)
+
+// ValidateCompressLevel confere o nivel do algoritmo, igual para o envio
+// (compression.level) e para os arquivos rotacionados (compress_level). 0 e
+// sempre o default; xz nao tem niveis.
+func ValidateCompressLevel(algorithm string, level int) error {
+	switch algorithm {
+	case CompressionGzip, CompressionDeflate:
+		if level < -2 || level > 9 {
+			return fmt.Errorf("nivel invalido para %s: %d (use -2 a 9)", algorithm, level)
+		}
+	case CompressionZstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("nivel invalido para zstd: %d (use 1 a 22)", level)
+		}
+	case CompressionXz:
+		if level != 0 {
+			return fmt.Errorf("nivel invalido para xz: %d (xz nao tem niveis, use 0)", level)
+		}
+	}
+	return nil
+}
+
+type CompressionConfig struct {
+	Algorithm string `json:"algorithm"`
+	Level     int    `json:"level,omitempty"`
+	Adaptive  bool   `json:"adaptive,omitempty"`
+	MinBytes  int    `json:"min_bytes,omitempty"`
+}
+
+type IngestConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Socket       string `json:"socket"`
+	SocketType   string `json:"socket_type"`
+	SyslogListen string `json:"syslog_listen,omitempty"`
+	Dir          string `json:"dir"`
+}
+
+type DiskBudgetConfig struct {
+	MaxTotalMB     int     `json:"max_total_mb,omitempty"`
+	MinFreeMB      int     `json:"min_free_mb,omitempty"`
+	MinFreePercent float64 `json:"min_free_percent,omitempty"`
+}
+
+type ThrottleWindow struct {
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	MaxBytesPerSec int64  `json:"max_bytes_per_sec"`
 }
 
 type Config struct {
-	Enabled               bool           `json:"enabled"`
-	Endpoint              string         `json:"endpoint"`
-	AuthToken             string         `json:"auth_token"`
-	AuthHeaderName        string         `json:"auth_header_name"`
-	DeviceID              string         `json:"device_id"`
-	RotateAt              string         `json:"rotate_at"`
-	ShipIntervalHours     int            `json:"ship_interval_hours"`
-	IntervalRotateSeconds int            `json:"interval_rotate_seconds"`
-	IntervalShipSeconds   int            `json:"interval_ship_seconds"`
-	MaxBytesPerShip       int            `json:"max_bytes_per_ship"`
-	ShipFormat            string         `json:"ship_format"`
-	Defaults              RotateDefaults `json:"defaults"`
+	Enabled               bool              `json:"enabled"`
+	Endpoint              string            `json:"endpoint"`
+	AuthToken             string            `json:"auth_token"`
+	AuthHeaderName        string            `json:"auth_header_name"`
+	DeviceID              string            `json:"device_id"`
+	RotateAt              string            `json:"rotate_at"`
+	RotateSchedule        string            `json:"rotate_schedule,omitempty"`
+	RotateTimezone        string            `json:"rotate_timezone,omitempty"`
+	ShipIntervalHours     int               `json:"ship_interval_hours"`
+	IntervalRotateSeconds int               `json:"interval_rotate_seconds"`
+	IntervalShipSeconds   int               `json:"interval_ship_seconds"`
+	MaxBytesPerShip       int               `json:"max_bytes_per_ship"`
+	ShipFormat            string            `json:"ship_format"`
+	Compression           CompressionConfig `json:"compression"`
+	MaxBytesPerSec        int64             `json:"max_bytes_per_sec"`
+	ThrottleSchedule      []ThrottleWindow  `json:"throttle_schedule,omitempty"`
+	Ingest                IngestConfig      `json:"ingest"`
+	DiskBudget            DiskBudgetConfig  `json:"disk_budget"`
+	Defaults              RotateDefaults    `json:"defaults"`
 }
 
 func DefaultConfig() Config {
@@ -48,7 +123,13 @@ func DefaultConfig() Config {
 		IntervalShipSeconds:   0,
 		MaxBytesPerShip:       256 * 1024,
 		ShipFormat:            "lines",
+		Compression:           CompressionConfig{Algorithm: CompressionGzip},
 		AuthHeaderName:        "x-auth-n8n",
+		Ingest: IngestConfig{
+			Socket:     DefaultIngestSocket,
+			SocketType: "unixgram",
+			Dir:        DefaultManagedDir + "/ingest",
+		},
 		Defaults: RotateDefaults{
 			MaxSizeMB:     50,
 			Keep:          10,
@@ -84,6 +165,21 @@ func ApplyDefaults(cfg Config) Config {
 	if cfg.AuthHeaderName == "" {
 		cfg.AuthHeaderName = def.AuthHeaderName
 	}
+	if cfg.Compression.Algorithm == "" {
+		cfg.Compression.Algorithm = def.Compression.Algorithm
+	}
+	if cfg.Ingest.Socket == "" {
+		cfg.Ingest.Socket = def.Ingest.Socket
+	}
+	if cfg.Ingest.SocketType == "" {
+		cfg.Ingest.SocketType = def.Ingest.SocketType
+	}
+	if cfg.Ingest.Dir == "" {
+		cfg.Ingest.Dir = def.Ingest.Dir
+	}
+	if cfg.MaxBytesPerSec < 0 {
+		cfg.MaxBytesPerSec = 0
+	}
 	if cfg.Defaults.MaxSizeMB <= 0 {
 		cfg.Defaults.MaxSizeMB = def.Defaults.MaxSizeMB
 	}
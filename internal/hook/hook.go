@@ -0,0 +1,155 @@
+package hook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"zid-logs/internal/registry"
+)
+
+const (
+	PreRotate  = "pre_rotate"
+	PostRotate = "post_rotate"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// maxOutput limita quanto de stdout/stderr vai para o log do daemon.
+	maxOutput = 64 * 1024
+	// waitDelay e quanto esperar pelos pipes depois de matar o grupo.
+	waitDelay = 2 * time.Second
+)
+
+// Env descreve a rotacao para o comando do hook.
+type Env struct {
+	Package string
+	LogID   string
+	Path    string
+	Archive string
+	CutTime time.Time
+}
+
+func (e Env) vars(name string) []string {
+	vars := []string{
+		"ZID_LOGS_HOOK=" + name,
+		"ZID_LOGS_PACKAGE=" + e.Package,
+		"ZID_LOGS_LOG_ID=" + e.LogID,
+		"ZID_LOGS_PATH=" + e.Path,
+		"ZID_LOGS_ARCHIVE=" + e.Archive,
+	}
+	if !e.CutTime.IsZero() {
+		vars = append(vars,
+			"ZID_LOGS_CUT_TIME="+e.CutTime.Format(time.RFC3339),
+			fmt.Sprintf("ZID_LOGS_CUT_UNIX=%d", e.CutTime.Unix()),
+		)
+	}
+	return vars
+}
+
+// Result e o desfecho de uma execucao; ExitCode e -1 quando o comando nem
+// terminou (timeout ou falha ao iniciar).
+type Result struct {
+	Hook     string
+	ExitCode int
+	Duration time.Duration
+	Err      error
+}
+
+func Timeout(cfg registry.HookConfig) time.Duration {
+	if cfg.TimeoutSeconds > 0 {
+		return time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return defaultTimeout
+}
+
+func Validate(name string, cfg *registry.HookConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if strings.TrimSpace(cfg.Command) == "" {
+		return fmt.Errorf("%s sem command", name)
+	}
+	if cfg.TimeoutSeconds < 0 {
+		return fmt.Errorf("%s.timeout_seconds invalido: %d", name, cfg.TimeoutSeconds)
+	}
+	return nil
+}
+
+// Run executa o comando via /bin/sh -c com as variaveis ZID_LOGS_*. Cada
+// linha de stdout/stderr vai para o log do daemon; no timeout o grupo de
+// processos inteiro e morto.
+func Run(ctx context.Context, name string, cfg registry.HookConfig, env Env) Result {
+	result := Result{Hook: name, ExitCode: -1}
+	runCtx, cancel := context.WithTimeout(ctx, Timeout(cfg))
+	defer cancel()
+
+	var output limitedBuffer
+	cmd := exec.CommandContext(runCtx, "/bin/sh", "-c", cfg.Command)
+	cmd.Env = append(os.Environ(), env.vars(name)...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = waitDelay
+
+	started := time.Now()
+	err := cmd.Run()
+	result.Duration = time.Since(started)
+	logOutput(name, env, output.Bytes())
+
+	var exitErr *exec.ExitError
+	switch {
+	case runCtx.Err() == context.DeadlineExceeded:
+		result.Err = fmt.Errorf("%s excedeu %s", name, Timeout(cfg))
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Err = fmt.Errorf("%s saiu com status %d", name, result.ExitCode)
+	case err != nil:
+		result.Err = fmt.Errorf("%s falhou: %w", name, err)
+	default:
+		result.ExitCode = 0
+	}
+	return result
+}
+
+func logOutput(name string, env Env, output []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 4096), maxOutput)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			log.Printf("%s %s/%s: %s", name, env.Package, env.LogID, line)
+		}
+	}
+}
+
+// limitedBuffer guarda ate maxOutput bytes e descarta o resto sem falhar a
+// escrita, para o comando nunca travar no pipe.
+type limitedBuffer struct {
+	buf bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
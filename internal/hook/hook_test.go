@@ -0,0 +1,66 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zid-logs/internal/registry"
+)
+
+func TestRunPassesEnvAndCapturesOutput(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	out := filepath.Join(t.TempDir(), "env.txt")
+	cut := time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)
+	env := Env{Package: "zid-proxy", LogID: "main", Path: "/var/log/p.log", Archive: "/var/log/p.log.1", CutTime: cut}
+	cfg := registry.HookConfig{Command: `echo "$ZID_LOGS_HOOK $ZID_LOGS_PACKAGE $ZID_LOGS_LOG_ID $ZID_LOGS_PATH $ZID_LOGS_ARCHIVE $ZID_LOGS_CUT_UNIX" > ` + out + `; echo saida; echo erro >&2`}
+
+	result := Run(context.Background(), PostRotate, cfg, env)
+	if result.Err != nil || result.ExitCode != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	data, _ := os.ReadFile(out)
+	want := "post_rotate zid-proxy main /var/log/p.log /var/log/p.log.1 1768867200\n"
+	if string(data) != want {
+		t.Fatalf("expected env %q, got %q", want, data)
+	}
+	for _, line := range []string{"post_rotate zid-proxy/main: saida", "post_rotate zid-proxy/main: erro"} {
+		if !strings.Contains(logged.String(), line) {
+			t.Fatalf("expected %q in daemon log, got %q", line, logged.String())
+		}
+	}
+}
+
+func TestRunExitStatusAndTimeout(t *testing.T) {
+	log.SetOutput(new(bytes.Buffer))
+	defer log.SetOutput(os.Stderr)
+
+	result := Run(context.Background(), PreRotate, registry.HookConfig{Command: "exit 3"}, Env{})
+	if result.ExitCode != 3 || result.Err == nil {
+		t.Fatalf("expected exit 3 with error, got %+v", result)
+	}
+
+	started := time.Now()
+	result = Run(context.Background(), PreRotate, registry.HookConfig{Command: "sleep 30 & sleep 30", TimeoutSeconds: 1}, Env{})
+	if result.ExitCode != -1 || result.Err == nil || !strings.Contains(result.Err.Error(), "excedeu") {
+		t.Fatalf("expected timeout, got %+v", result)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("timeout took %s", elapsed)
+	}
+
+	if err := Validate(PreRotate, &registry.HookConfig{}); err == nil {
+		t.Fatalf("expected error for hook without command")
+	}
+	if err := Validate(PostRotate, nil); err != nil {
+		t.Fatalf("nil hook should be valid: %v", err)
+	}
+}
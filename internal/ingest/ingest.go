@@ -0,0 +1,344 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/managed"
+	"zid-logs/internal/registry"
+)
+
+const (
+	SocketDatagram = "unixgram"
+	SocketStream   = "unix"
+
+	maxMessageSize = 64 * 1024
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type Message struct {
+	Package string   `json:"package"`
+	LogID   string   `json:"log_id"`
+	Line    string   `json:"line,omitempty"`
+	Lines   []string `json:"lines,omitempty"`
+}
+
+type Server struct {
+	cfg       config.IngestConfig
+	inputsDir string
+
+	mu        sync.Mutex
+	files     map[string]*managed.Writer
+	listeners []func() error
+	wg        sync.WaitGroup
+}
+
+func NewServer(cfg config.IngestConfig, inputsDir string) *Server {
+	return &Server{
+		cfg:       cfg,
+		inputsDir: inputsDir,
+		files:     make(map[string]*managed.Writer),
+	}
+}
+
+// Start abre o socket local e, se configurado, o listener syslog UDP.
+func Start(cfg config.IngestConfig, inputsDir string) (*Server, error) {
+	s := NewServer(cfg, inputsDir)
+	if err := s.listenSocket(); err != nil {
+		return nil, err
+	}
+	if cfg.SyslogListen != "" {
+		if err := s.listenSyslog(); err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	closers := s.listeners
+	s.listeners = nil
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, closeFn := range closers {
+		if err := closeFn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, w := range s.files {
+		_ = w.Close()
+		delete(s.files, path)
+	}
+	return firstErr
+}
+
+func (s *Server) listenSocket() error {
+	path := s.cfg.Socket
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+
+	switch s.cfg.SocketType {
+	case SocketStream:
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return err
+		}
+		_ = os.Chmod(path, 0660)
+		s.addCloser(func() error {
+			err := ln.Close()
+			_ = os.Remove(path)
+			return err
+		})
+		s.wg.Add(1)
+		go s.acceptLoop(ln)
+	default:
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		_ = os.Chmod(path, 0660)
+		s.addCloser(func() error {
+			err := conn.Close()
+			_ = os.Remove(path)
+			return err
+		})
+		s.wg.Add(1)
+		go s.packetLoop(conn, ParseMessage)
+	}
+	return nil
+}
+
+func (s *Server) listenSyslog() error {
+	conn, err := net.ListenPacket("udp", s.cfg.SyslogListen)
+	if err != nil {
+		return err
+	}
+	s.addCloser(conn.Close)
+	s.wg.Add(1)
+	go s.packetLoop(conn, func(data []byte) ([]Message, error) {
+		msg, err := ParseSyslog(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Message{msg}, nil
+	})
+	return nil
+}
+
+func (s *Server) addCloser(fn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+func (s *Server) packetLoop(conn net.PacketConn, parse func([]byte) ([]Message, error)) {
+	defer s.wg.Done()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.handle(buf[:n], parse)
+	}
+}
+
+func (s *Server) acceptLoop(ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			scanner.Buffer(make([]byte, 4096), maxMessageSize)
+			for scanner.Scan() {
+				s.handle(scanner.Bytes(), ParseMessage)
+			}
+		}()
+	}
+}
+
+func (s *Server) handle(data []byte, parse func([]byte) ([]Message, error)) {
+	msgs, err := parse(data)
+	if err != nil {
+		log.Printf("ingest: mensagem descartada: %v", err)
+		return
+	}
+	for _, msg := range msgs {
+		if err := s.Write(msg); err != nil {
+			log.Printf("ingest: erro ao gravar %s/%s: %v", msg.Package, msg.LogID, err)
+		}
+	}
+}
+
+// Write grava as linhas no arquivo gerenciado do par package/log_id e
+// registra o arquivo como input na primeira vez.
+func (s *Server) Write(msg Message) error {
+	if !validName.MatchString(msg.Package) || !validName.MatchString(msg.LogID) {
+		return fmt.Errorf("package/log_id invalido: %q/%q", msg.Package, msg.LogID)
+	}
+	lines := msg.Lines
+	if msg.Line != "" {
+		lines = append([]string{msg.Line}, lines...)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	path := ManagedPath(s.cfg.Dir, msg.Package, msg.LogID)
+	var buf strings.Builder
+	for _, line := range lines {
+		buf.WriteString(strings.TrimRight(line, "\r\n"))
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	w, ok := s.files[path]
+	if !ok {
+		w = managed.NewWriter(path)
+		s.files[path] = w
+		name := fmt.Sprintf("ingest-%s-%s", msg.Package, msg.LogID)
+		input := registry.LogInput{Package: msg.Package, LogID: msg.LogID, Path: path}
+		if err := managed.Register(s.inputsDir, name, input); err != nil {
+			log.Printf("ingest: erro ao registrar %s: %v", path, err)
+		}
+	}
+	s.mu.Unlock()
+
+	_, err := w.Write([]byte(buf.String()))
+	return err
+}
+
+func ManagedPath(dir, pkg, logID string) string {
+	return filepath.Join(dir, pkg, logID+".log")
+}
+
+// ParseMessage aceita JSON ({"package","log_id","line"|"lines"}) ou texto
+// no formato "<package> <log_id> <linha>".
+func ParseMessage(data []byte) ([]Message, error) {
+	text := strings.TrimRight(string(data), "\r\n")
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("mensagem vazia")
+	}
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		var msg Message
+		if err := json.Unmarshal([]byte(text), &msg); err != nil {
+			return nil, err
+		}
+		return []Message{msg}, nil
+	}
+	parts := strings.SplitN(text, " ", 3)
+	if len(parts) < 3 {
+		return nil, errors.New("formato esperado: <package> <log_id> <linha>")
+	}
+	return []Message{{Package: parts[0], LogID: parts[1], Line: parts[2]}}, nil
+}
+
+// ParseSyslog extrai package/log_id da tag (APP-NAME) de mensagens RFC 3164
+// ou RFC 5424. A tag "pacote/log" define ambos; sem "/" o log_id e "syslog".
+func ParseSyslog(data []byte) (Message, error) {
+	text := strings.TrimRight(string(data), "\r\n\x00")
+	if !strings.HasPrefix(text, "<") {
+		return Message{}, errors.New("syslog sem PRI")
+	}
+	end := strings.IndexByte(text, '>')
+	if end < 0 {
+		return Message{}, errors.New("syslog sem PRI")
+	}
+	rest := text[end+1:]
+
+	var tag, body string
+	if strings.HasPrefix(rest, "1 ") {
+		fields := strings.SplitN(rest, " ", 7)
+		if len(fields) < 7 {
+			return Message{}, errors.New("syslog rfc5424 incompleto")
+		}
+		tag = fields[3]
+		body = skipStructuredData(fields[6])
+	} else {
+		if len(rest) >= 16 && rest[3] == ' ' && rest[9] == ':' && rest[15] == ' ' {
+			rest = rest[16:]
+		}
+		first := rest
+		if sp := strings.IndexByte(rest, ' '); sp >= 0 {
+			first = rest[:sp]
+			if !strings.HasSuffix(first, ":") && !strings.Contains(first, "[") {
+				rest = rest[sp+1:]
+			}
+		}
+		colon := strings.IndexByte(rest, ':')
+		if colon < 0 {
+			return Message{}, errors.New("syslog sem tag")
+		}
+		tag = rest[:colon]
+		body = strings.TrimPrefix(rest[colon+1:], " ")
+	}
+	if bracket := strings.IndexByte(tag, '['); bracket >= 0 {
+		tag = tag[:bracket]
+	}
+
+	msg := Message{Package: tag, LogID: "syslog", Line: body}
+	if slash := strings.IndexByte(tag, '/'); slash >= 0 {
+		msg.Package = tag[:slash]
+		msg.LogID = tag[slash+1:]
+	}
+	if msg.Package == "" || msg.Package == "-" {
+		return Message{}, errors.New("syslog sem tag")
+	}
+	return msg, nil
+}
+
+func skipStructuredData(rest string) string {
+	if strings.HasPrefix(rest, "-") {
+		return strings.TrimPrefix(rest[1:], " ")
+	}
+	for strings.HasPrefix(rest, "[") {
+		end := -1
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == ']' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return ""
+		}
+		rest = rest[end+1:]
+	}
+	return strings.TrimPrefix(rest, " ")
+}
@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/managed"
+	"zid-logs/internal/registry"
+)
+
+func TestParseMessageFormats(t *testing.T) {
+	msgs, err := ParseMessage([]byte(`{"package":"zid-proxy","log_id":"access","lines":["a","b"]}`))
+	if err != nil || len(msgs) != 1 || len(msgs[0].Lines) != 2 {
+		t.Fatalf("unexpected json parse: %+v %v", msgs, err)
+	}
+
+	msgs, err = ParseMessage([]byte("zid-proxy access GET / 200\n"))
+	if err != nil {
+		t.Fatalf("text parse error: %v", err)
+	}
+	if msgs[0].Package != "zid-proxy" || msgs[0].LogID != "access" || msgs[0].Line != "GET / 200" {
+		t.Fatalf("unexpected text parse: %+v", msgs[0])
+	}
+
+	if _, err := ParseMessage([]byte("only-two fields")); err == nil {
+		t.Fatalf("expected error for short text message")
+	}
+}
+
+func TestParseSyslog(t *testing.T) {
+	cases := []struct {
+		raw   string
+		pkg   string
+		logID string
+		line  string
+	}{
+		{"<134>Oct 17 10:00:01 fw zid-proxy/access[123]: GET / 200", "zid-proxy", "access", "GET / 200"},
+		{"<134>Oct 17 10:00:01 openvpn: client connected", "openvpn", "syslog", "client connected"},
+		{"<14>1 2026-10-17T10:00:01Z fw zid-geo/events 42 - - blocked BR", "zid-geo", "events", "blocked BR"},
+		{`<14>1 2026-10-17T10:00:01Z fw zid-geo 42 ID1 [meta a="1\]"] hello`, "zid-geo", "syslog", "hello"},
+	}
+	for _, tc := range cases {
+		msg, err := ParseSyslog([]byte(tc.raw))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.raw, err)
+		}
+		if msg.Package != tc.pkg || msg.LogID != tc.logID || msg.Line != tc.line {
+			t.Fatalf("%q: unexpected %+v", tc.raw, msg)
+		}
+	}
+}
+
+func TestServerWritesAndRegisters(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.IngestConfig{
+		Socket:     filepath.Join(dir, "ingest.sock"),
+		SocketType: SocketDatagram,
+		Dir:        filepath.Join(dir, "managed"),
+	}
+	inputsDir := filepath.Join(dir, "inputs.d")
+
+	srv, err := Start(cfg, inputsDir)
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer srv.Close()
+
+	conn, err := net.Dial("unixgram", cfg.Socket)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	for _, msg := range []string{"zid-proxy access first", "zid-proxy access second", "../evil x y"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	path := ManagedPath(cfg.Dir, "zid-proxy", "access")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if string(data) == "first\nsecond\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected managed file content: %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	inputs, err := registry.LoadInputs(inputsDir)
+	if err != nil {
+		t.Fatalf("LoadInputs error: %v", err)
+	}
+	if len(inputs) != 1 || inputs[0].Path != path || inputs[0].LogID != "access" {
+		t.Fatalf("unexpected registered inputs: %+v", inputs)
+	}
+}
+
+func TestServerReopensAfterRotation(t *testing.T) {
+	dir := t.TempDir()
+	srv := NewServer(config.IngestConfig{Dir: dir}, "")
+	defer srv.Close()
+
+	msg := Message{Package: "p", LogID: "l", Line: "before"}
+	if err := srv.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	path := ManagedPath(dir, "p", "l")
+	release := managed.Hold(path)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	release()
+
+	msg.Line = "after"
+	if err := srv.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read live: %v", err)
+	}
+	if string(data) != "after\n" {
+		t.Fatalf("expected new live file, got %q", data)
+	}
+}
@@ -0,0 +1,142 @@
+package managed
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"zid-logs/internal/registry"
+)
+
+const reopenInterval = time.Second
+
+var (
+	writersMu sync.Mutex
+	writers   = make(map[string]*Writer)
+)
+
+// Writer acrescenta dados a um arquivo gerenciado pelo zid-logs e reabre o
+// caminho quando a rotacao troca o inode, dispensando post-rotate. A rotacao
+// do proprio zid-logs pausa o writer com Hold.
+type Writer struct {
+	path string
+
+	mu        sync.Mutex
+	file      *os.File
+	checkedAt time.Time
+}
+
+func NewWriter(path string) *Writer {
+	w := &Writer{path: path}
+	writersMu.Lock()
+	writers[filepath.Clean(path)] = w
+	writersMu.Unlock()
+	return w
+}
+
+func (w *Writer) Path() string {
+	return w.path
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.openLocked(); err != nil {
+		return 0, err
+	}
+	return w.file.Write(p)
+}
+
+func (w *Writer) Close() error {
+	writersMu.Lock()
+	if writers[filepath.Clean(w.path)] == w {
+		delete(writers, filepath.Clean(w.path))
+	}
+	writersMu.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Hold pausa as escritas do writer de path e fecha o arquivo dele, para que
+// a rotacao renomeie o arquivo sem que linhas ainda caiam no arquivo antigo.
+// A primeira escrita depois de release abre o arquivo novo. Sem writer para
+// path, Hold nao faz nada.
+func Hold(path string) (release func()) {
+	writersMu.Lock()
+	w := writers[filepath.Clean(path)]
+	writersMu.Unlock()
+	if w == nil {
+		return func() {}
+	}
+	w.mu.Lock()
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	var once sync.Once
+	return func() { once.Do(w.mu.Unlock) }
+}
+
+func (w *Writer) openLocked() error {
+	now := time.Now()
+	if w.file != nil {
+		if now.Sub(w.checkedAt) < reopenInterval {
+			return nil
+		}
+		w.checkedAt = now
+		cur, err := os.Stat(w.path)
+		open, statErr := w.file.Stat()
+		if err == nil && statErr == nil && os.SameFile(cur, open) {
+			return nil
+		}
+		_ = w.file.Close()
+		w.file = nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.checkedAt = now
+	return nil
+}
+
+// Register grava o input em inputsDir/<name>.json caso ainda nao exista.
+func Register(inputsDir, name string, input registry.LogInput) error {
+	if inputsDir == "" {
+		return nil
+	}
+	target := filepath.Join(inputsDir, name+".json")
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(inputsDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent([]registry.LogInput{input}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("registro %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package naming concentra as regras de nome das geracoes rotacionadas,
+// compartilhadas pela rotacao e pela expansao de globs do registro.
+package naming
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Numeric = "numeric"
+	Date    = "date"
+
+	DefaultDateFormat = "-%Y%m%d"
+)
+
+var CompressedExts = []string{".gz", ".zst", ".xz"}
+
+// Generation e o sufixo interpretado de uma geracao: Index no modo numerico,
+// Period (e Seq, quando ha mais de uma no mesmo periodo) no modo date.
+type Generation struct {
+	Index      int
+	Period     time.Time
+	Seq        int
+	Compressed bool
+}
+
+// DateLayout converte o formato estilo strftime para layout do Go.
+func DateLayout(format string) (string, error) {
+	if format == "" {
+		format = DefaultDateFormat
+	}
+	var b strings.Builder
+	hasDate := false
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			if c >= '0' && c <= '9' {
+				return "", fmt.Errorf("date_format nao aceita digitos literais: %s", format)
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 >= len(format) {
+			return "", fmt.Errorf("date_format invalido: %s", format)
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			b.WriteString("2006")
+		case 'm':
+			b.WriteString("01")
+		case 'd':
+			b.WriteString("02")
+		case 'H':
+			b.WriteString("15")
+		case 'M':
+			b.WriteString("04")
+		case 'S':
+			b.WriteString("05")
+		case '%':
+			b.WriteByte('%')
+			continue
+		default:
+			return "", fmt.Errorf("date_format: %%%c nao suportado", format[i])
+		}
+		hasDate = true
+	}
+	if !hasDate {
+		return "", fmt.Errorf("date_format sem data: %s", format)
+	}
+	return b.String(), nil
+}
+
+// Parse interpreta name como geracao de base: base.N, ou base seguido da data
+// em layout (com .N opcional), com ou sem extensao de compressao. Com layout
+// vazio so o modo numerico e reconhecido.
+func Parse(base, name, layout string) (Generation, bool) {
+	if name == base || !strings.HasPrefix(name, base) {
+		return Generation{}, false
+	}
+	rest := name[len(base):]
+	var gen Generation
+	for _, ext := range CompressedExts {
+		if strings.HasSuffix(rest, ext) {
+			rest = strings.TrimSuffix(rest, ext)
+			gen.Compressed = true
+			break
+		}
+	}
+	if index, ok := NumericSuffix(rest); ok {
+		gen.Index = index
+		return gen, true
+	}
+	if layout == "" {
+		return Generation{}, false
+	}
+	if dot := strings.LastIndexByte(rest, '.'); dot > 0 {
+		if seq, ok := NumericSuffix(rest[dot:]); ok {
+			gen.Seq = seq
+			rest = rest[:dot]
+		}
+	}
+	period, err := time.ParseInLocation(layout, rest, time.Local)
+	if err != nil {
+		return Generation{}, false
+	}
+	gen.Period = period
+	return gen, true
+}
+
+// NumericSuffix interpreta ".N" com N >= 1 e sem zeros a esquerda.
+func NumericSuffix(rest string) (int, bool) {
+	if len(rest) < 2 || rest[0] != '.' {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest[1:])
+	if err != nil || n < 1 || strconv.Itoa(n) != rest[1:] {
+		return 0, false
+	}
+	return n, true
+}
+
+// Staged retorna o arquivo de preparo do corte por timestamp de path.
+func Staged(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".cut")
+}
+
+// Temporary reconhece arquivos intermediarios da rotacao: copias e
+// compressoes em andamento (nome.tmp.*) e o preparo do corte (.nome.cut).
+func Temporary(path string) bool {
+	name := filepath.Base(path)
+	if strings.Contains(name, ".tmp.") {
+		return true
+	}
+	return len(name) > len("..cut") && strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".cut")
+}
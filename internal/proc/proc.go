@@ -0,0 +1,123 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"zid-logs/internal/registry"
+)
+
+// ErrNoProcess indica que nenhum processo casou com o filtro.
+var ErrNoProcess = errors.New("nenhum processo encontrado")
+
+type Process struct {
+	PID  int
+	PPID int
+	Name string
+	Args []string
+}
+
+// CommandLine e o argv unido por espacos, como o pgrep -f compara; sem argv
+// (threads do kernel) usa o nome.
+func (p Process) CommandLine() string {
+	if len(p.Args) == 0 {
+		return p.Name
+	}
+	return strings.Join(p.Args, " ")
+}
+
+// Lister lista os processos do sistema (/proc no Linux, sysctl no FreeBSD).
+type Lister interface {
+	List() ([]Process, error)
+}
+
+func NewLister() Lister {
+	return nativeLister{}
+}
+
+// Matcher seleciona processos por nome exato, regex sobre o argv e
+// restricoes de processo pai; todos os criterios informados precisam casar.
+type Matcher struct {
+	name       string
+	args       *regexp.Regexp
+	ppid       int
+	parentName string
+}
+
+func NewMatcher(m registry.ProcessMatch) (*Matcher, error) {
+	matcher := &Matcher{
+		name:       strings.TrimSpace(m.Name),
+		ppid:       m.PPID,
+		parentName: strings.TrimSpace(m.ParentName),
+	}
+	if m.ArgsRegex != "" {
+		re, err := regexp.Compile(m.ArgsRegex)
+		if err != nil {
+			return nil, fmt.Errorf("args_regex invalido: %w", err)
+		}
+		matcher.args = re
+	}
+	if m.PPID < 0 {
+		return nil, fmt.Errorf("ppid invalido: %d", m.PPID)
+	}
+	if matcher.name == "" && matcher.args == nil {
+		return nil, errors.New("post_rotate_process exige name ou args_regex")
+	}
+	return matcher, nil
+}
+
+// Find retorna os processos que casam, exceto o proprio zid-logs.
+func (m *Matcher) Find(procs []Process) []Process {
+	names := make(map[int]string, len(procs))
+	for _, p := range procs {
+		names[p.PID] = p.Name
+	}
+	self := os.Getpid()
+	var out []Process
+	for _, p := range procs {
+		if p.PID == self {
+			continue
+		}
+		if m.name != "" && p.Name != m.name {
+			continue
+		}
+		if m.args != nil && !m.args.MatchString(p.CommandLine()) {
+			continue
+		}
+		if m.ppid > 0 && p.PPID != m.ppid {
+			continue
+		}
+		if m.parentName != "" && names[p.PPID] != m.parentName {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// Signal envia sig a todos os processos que casam e retorna os pids
+// sinalizados; falhas de kill sao devolvidas juntas.
+func Signal(l Lister, m *Matcher, sig syscall.Signal) ([]int, error) {
+	procs, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+	matched := m.Find(procs)
+	if len(matched) == 0 {
+		return nil, ErrNoProcess
+	}
+	var pids []int
+	var errs []error
+	for _, p := range matched {
+		if err := syscall.Kill(p.PID, sig); err != nil {
+			errs = append(errs, fmt.Errorf("pid %d: %w", p.PID, err))
+			continue
+		}
+		pids = append(pids, p.PID)
+	}
+	return pids, errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+//go:build freebsd
+
+package proc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Offsets de struct kinfo_proc (sys/user.h) em plataformas de 64 bits.
+const (
+	kinfoPidOffset  = 72
+	kinfoPpidOffset = 76
+	kinfoCommOffset = 447
+	kinfoCommLen    = 20
+)
+
+type nativeLister struct{}
+
+func (nativeLister) List() ([]Process, error) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		return nil, errors.New("listagem de processos exige plataforma de 64 bits")
+	}
+	buf, err := unix.SysctlRaw("kern.proc.proc")
+	if err != nil {
+		return nil, err
+	}
+	var procs []Process
+	for len(buf) >= 4 {
+		size := int(binary.LittleEndian.Uint32(buf))
+		if size < kinfoCommOffset+kinfoCommLen || size > len(buf) {
+			return nil, errors.New("kinfo_proc com tamanho inesperado")
+		}
+		record := buf[:size]
+		buf = buf[size:]
+
+		comm := record[kinfoCommOffset : kinfoCommOffset+kinfoCommLen]
+		if i := bytes.IndexByte(comm, 0); i >= 0 {
+			comm = comm[:i]
+		}
+		p := Process{
+			PID:  int(int32(binary.LittleEndian.Uint32(record[kinfoPidOffset:]))),
+			PPID: int(int32(binary.LittleEndian.Uint32(record[kinfoPpidOffset:]))),
+			Name: string(comm),
+		}
+		// kern.proc.args falha para processos que ja terminaram ou de outros
+		// usuarios sem permissao; fica so o nome
+		if args, err := unix.SysctlRaw("kern.proc.args", p.PID); err == nil {
+			args = bytes.TrimRight(args, "\x00")
+			if len(args) > 0 {
+				p.Args = strings.Split(string(args), "\x00")
+			}
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
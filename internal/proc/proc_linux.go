@@ -0,0 +1,61 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type nativeLister struct{}
+
+func (nativeLister) List() ([]Process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var procs []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// processos que terminam durante a listagem sao ignorados
+		p, ok := readProcess(pid)
+		if ok {
+			procs = append(procs, p)
+		}
+	}
+	return procs, nil
+}
+
+func readProcess(pid int) (Process, bool) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return Process{}, false
+	}
+	// "pid (comm) estado ppid ...": comm pode conter espacos e parenteses
+	open := bytes.IndexByte(stat, '(')
+	end := bytes.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return Process{}, false
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 2 {
+		return Process{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	p := Process{PID: pid, PPID: ppid, Name: string(stat[open+1 : end])}
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		cmdline = bytes.TrimRight(cmdline, "\x00")
+		if len(cmdline) > 0 {
+			p.Args = strings.Split(string(cmdline), "\x00")
+		}
+	}
+	return p, true
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !freebsd
+
+package proc
+
+import "errors"
+
+type nativeLister struct{}
+
+func (nativeLister) List() ([]Process, error) {
+	return nil, errors.New("listagem de processos indisponivel")
+}
@@ -0,0 +1,94 @@
+package proc
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"zid-logs/internal/registry"
+)
+
+type staticLister []Process
+
+func (l staticLister) List() ([]Process, error) {
+	return l, nil
+}
+
+func TestMatcherModes(t *testing.T) {
+	procs := []Process{
+		{PID: 1, PPID: 0, Name: "init", Args: []string{"/sbin/init"}},
+		{PID: 10, PPID: 1, Name: "zid-proxy", Args: []string{"/usr/local/sbin/zid-proxy", "-c", "/etc/proxy.conf"}},
+		{PID: 11, PPID: 10, Name: "zid-proxy", Args: []string{"zid-proxy: worker"}},
+		{PID: 20, PPID: 1, Name: "zid-proxy-helper", Args: []string{"/usr/local/sbin/zid-proxy-helper"}},
+		{PID: os.Getpid(), PPID: 1, Name: "zid-proxy", Args: []string{"zid-proxy"}},
+	}
+	cases := []struct {
+		match registry.ProcessMatch
+		want  []int
+	}{
+		{registry.ProcessMatch{Name: "zid-proxy"}, []int{10, 11}},
+		{registry.ProcessMatch{ArgsRegex: `zid-proxy.*-c /etc/proxy\.conf`}, []int{10}},
+		{registry.ProcessMatch{ArgsRegex: `zid-proxy`}, []int{10, 11, 20}},
+		{registry.ProcessMatch{Name: "zid-proxy", PPID: 1}, []int{10}},
+		{registry.ProcessMatch{Name: "zid-proxy", ParentName: "zid-proxy"}, []int{11}},
+	}
+	for _, tc := range cases {
+		m, err := NewMatcher(tc.match)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.match, err)
+		}
+		var got []int
+		for _, p := range m.Find(procs) {
+			got = append(got, p.PID)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("%+v: expected %v, got %v", tc.match, tc.want, got)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("%+v: expected %v, got %v", tc.match, tc.want, got)
+			}
+		}
+	}
+
+	for _, bad := range []registry.ProcessMatch{{}, {PPID: 1}, {ArgsRegex: "("}, {Name: "x", PPID: -1}} {
+		if _, err := NewMatcher(bad); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+	m, _ := NewMatcher(registry.ProcessMatch{Name: "ausente"})
+	if _, err := Signal(staticLister(procs), m, syscall.SIGHUP); !errors.Is(err, ErrNoProcess) {
+		t.Fatalf("expected ErrNoProcess, got %v", err)
+	}
+}
+
+func TestNativeListerSignalsChild(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "freebsd" {
+		t.Skip("listagem nativa indisponivel")
+	}
+	cmd := exec.Command("/bin/sh", "-c", "sleep 30; : zid-logs-proc-test")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	m, err := NewMatcher(registry.ProcessMatch{ArgsRegex: "zid-logs-proc-test", PPID: os.Getpid()})
+	if err != nil {
+		t.Fatalf("matcher: %v", err)
+	}
+	pids, err := Signal(NewLister(), m, syscall.SIGTERM)
+	if err != nil || len(pids) != 1 || pids[0] != cmd.Process.Pid {
+		t.Fatalf("expected to signal %d, got %v (%v)", cmd.Process.Pid, pids, err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("child did not exit after SIGTERM")
+	}
+}
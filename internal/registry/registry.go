@@ -5,28 +5,119 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/naming"
 )
 
 type InputPolicy struct {
-	MaxSizeMB   int   `json:"max_size_mb,omitempty"`
-	Keep        int   `json:"keep,omitempty"`
-	Compress    *bool `json:"compress,omitempty"`
-	MaxAgeDays  int   `json:"max_age_days,omitempty"`
-	ShipEnabled *bool `json:"ship_enabled,omitempty"`
+	MaxSizeMB         int    `json:"max_size_mb,omitempty"`
+	Keep              int    `json:"keep,omitempty"`
+	Compress          *bool  `json:"compress,omitempty"`
+	MaxAgeDays        int    `json:"max_age_days,omitempty"`
+	ShipEnabled       *bool  `json:"ship_enabled,omitempty"`
+	RotateEnabled     *bool  `json:"rotate_enabled,omitempty"`
+	MaxBytesPerSec    int64  `json:"max_bytes_per_sec,omitempty"`
+	MaxBacklogBytes   int64  `json:"max_backlog_bytes,omitempty"`
+	MaxLag            string `json:"max_lag,omitempty"`
+	CatchUp           string `json:"catch_up,omitempty"`
+	Naming            string `json:"naming,omitempty"`
+	DateFormat        string `json:"date_format,omitempty"`
+	MaxArchiveAgeDays int    `json:"archive_max_age_days,omitempty"`
+	ArchiveDir        string `json:"archive_dir,omitempty"`
+	PrunePriority     int    `json:"prune_priority,omitempty"`
+	MaxArchiveTotalMB int    `json:"archive_max_total_mb,omitempty"`
+	LegalHold         bool   `json:"legal_hold,omitempty"`
+	RotateMode        string `json:"rotate_mode,omitempty"`
+	CompressFormat    string `json:"compress_format,omitempty"`
+	CompressLevel     int    `json:"compress_level,omitempty"`
+	DelayCompress     *bool  `json:"delay_compress,omitempty"`
+}
+
+type StreamPolicy struct {
+	MaxLines int   `json:"max_lines,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	FlushMs  int   `json:"flush_ms,omitempty"`
+}
+
+// HookConfig e um comando executado antes ou depois da rotacao do input.
+type HookConfig struct {
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// ProcessMatch escolhe os processos que recebem o post_rotate_signal; todos
+// os criterios informados precisam casar.
+type ProcessMatch struct {
+	Name       string `json:"name,omitempty"`
+	ArgsRegex  string `json:"args_regex,omitempty"`
+	PPID       int    `json:"ppid,omitempty"`
+	ParentName string `json:"parent_name,omitempty"`
+}
+
+// TimestampConfig descreve onde e como achar o timestamp de cada linha.
+type TimestampConfig struct {
+	Layouts  []string `json:"layouts,omitempty"`
+	Regex    string   `json:"regex,omitempty"`
+	Mode     string   `json:"mode,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
 }
 
 type LogInput struct {
-	Package           string      `json:"package"`
-	LogID             string      `json:"log_id"`
-	Path              string      `json:"path"`
-	Policy            InputPolicy `json:"policy"`
-	TimestampLayout   string      `json:"timestamp_layout,omitempty"`
-	PostRotateSignal  string      `json:"post_rotate_signal,omitempty"`
-	PostRotatePidfile string      `json:"post_rotate_pidfile,omitempty"`
-	PostRotateMatch   string      `json:"post_rotate_match,omitempty"`
-	PostRotateCommand string      `json:"post_rotate_command,omitempty"`
-	Source            string      `json:"-"`
+	Package           string           `json:"package"`
+	LogID             string           `json:"log_id"`
+	Path              string           `json:"path"`
+	Policy            InputPolicy      `json:"policy"`
+	Mode              string           `json:"mode,omitempty"`
+	Type              string           `json:"type,omitempty"`
+	Command           string           `json:"command,omitempty"`
+	IntervalSeconds   int              `json:"interval_seconds,omitempty"`
+	TimeoutSeconds    int              `json:"timeout_seconds,omitempty"`
+	FifoPath          string           `json:"fifo_path,omitempty"`
+	Stream            StreamPolicy     `json:"stream,omitempty"`
+	TimestampLayout   string           `json:"timestamp_layout,omitempty"`
+	Timestamp         *TimestampConfig `json:"timestamp,omitempty"`
+	RotateSchedule    string           `json:"rotate_schedule,omitempty"`
+	RotateTimezone    string           `json:"rotate_timezone,omitempty"`
+	PostRotateSignal  string           `json:"post_rotate_signal,omitempty"`
+	PostRotatePidfile string           `json:"post_rotate_pidfile,omitempty"`
+	PostRotateMatch   string           `json:"post_rotate_match,omitempty"`
+	PostRotateCommand string           `json:"post_rotate_command,omitempty"`
+	PostRotateProcess *ProcessMatch    `json:"post_rotate_process,omitempty"`
+	PreRotate         *HookConfig      `json:"pre_rotate,omitempty"`
+	PostRotate        *HookConfig      `json:"post_rotate,omitempty"`
+	OnMissing         string           `json:"on_missing,omitempty"`
+	StartPosition     string           `json:"start_position,omitempty"`
+	Source            string           `json:"-"`
+	Pattern           string           `json:"-"`
+}
+
+const (
+	OnMissingKeep   = "keep"
+	OnMissingForget = "forget"
+
+	TypeFile = "file"
+	TypeExec = "exec"
+	TypeFifo = "fifo"
+
+	ExecTimestampLayout = "2006-01-02T15:04:05Z07:00"
+)
+
+func InputType(input LogInput) string {
+	switch strings.ToLower(strings.TrimSpace(input.Type)) {
+	case TypeExec:
+		return TypeExec
+	case TypeFifo:
+		return TypeFifo
+	}
+	return TypeFile
+}
+
+// ManagedPath e o arquivo buffer usado por inputs exec/fifo sem path.
+func ManagedPath(input LogInput) string {
+	return filepath.Join(config.DefaultManagedDir, InputType(input), input.Package, input.LogID+".log")
 }
 
 type InputFile struct {
@@ -59,6 +150,107 @@ func LoadInputs(dir string) ([]LogInput, error) {
 	return inputs, nil
 }
 
+func IsPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// ExpandInputs troca cada input com glob no path por um input por arquivo
+// encontrado, preservando o padrao original em Pattern. Geracoes rotacionadas
+// (.1, .2.gz, ...) nunca entram como arquivo novo. Inputs exec/fifo sem path
+// recebem o arquivo buffer gerenciado.
+func ExpandInputs(inputs []LogInput, defaults config.RotateDefaults) []LogInput {
+	var out []LogInput
+	for _, input := range inputs {
+		if InputType(input) != TypeFile {
+			if input.Path == "" {
+				input.Path = ManagedPath(input)
+			}
+			if InputType(input) == TypeExec && input.TimestampLayout == "" && input.Timestamp == nil {
+				input.TimestampLayout = ExecTimestampLayout
+			}
+			out = append(out, input)
+			continue
+		}
+		if !IsPattern(input.Path) {
+			out = append(out, input)
+			continue
+		}
+		matches, err := filepath.Glob(input.Path)
+		if err != nil {
+			continue
+		}
+		layout := dateLayout(input, defaults)
+		var live []string
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || naming.Temporary(match) {
+				continue
+			}
+			live = append(live, match)
+		}
+		for _, match := range liveFiles(live, layout) {
+			item := input
+			item.Pattern = input.Path
+			item.Path = match
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// liveFiles descarta as geracoes rotacionadas de outro arquivo do mesmo glob,
+// reconhecidas pelo nome que a rotacao do input gera (.N e, com layout, a
+// data do date_format). Um nome so e geracao de um arquivo que ja ficou como
+// log vivo, entao logs que terminam em data ou numero continuam valendo.
+func liveFiles(matches []string, layout string) []string {
+	sorted := append([]string(nil), matches...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) < len(sorted[j]) })
+	keep := make(map[string]bool)
+	var bases []string
+	for _, match := range sorted {
+		rotated := false
+		for _, base := range bases {
+			if _, ok := naming.Parse(base, match, layout); ok {
+				rotated = true
+				break
+			}
+		}
+		if !rotated {
+			bases = append(bases, match)
+			keep[match] = true
+		}
+	}
+	var out []string
+	for _, match := range matches {
+		if keep[match] {
+			out = append(out, match)
+		}
+	}
+	return out
+}
+
+// dateLayout retorna o layout das geracoes por data do input: com naming
+// date ou date_format configurado (no input ou no padrao global); vazio
+// quando o input so gera nomes numericos ou o formato e invalido.
+func dateLayout(input LogInput, defaults config.RotateDefaults) string {
+	mode := input.Policy.Naming
+	if mode == "" {
+		mode = defaults.Naming
+	}
+	format := input.Policy.DateFormat
+	if format == "" {
+		format = defaults.DateFormat
+	}
+	if mode != naming.Date && format == "" {
+		return ""
+	}
+	layout, err := naming.DateLayout(format)
+	if err != nil {
+		return ""
+	}
+	return layout
+}
+
 func parseInputFile(path string) ([]LogInput, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -3,7 +3,10 @@ package registry
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"zid-logs/internal/config"
 )
 
 func TestLoadInputsVariants(t *testing.T) {
@@ -41,3 +44,109 @@ func TestLoadInputsVariants(t *testing.T) {
 		}
 	}
 }
+
+func TestExpandInputsGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log", "a.log.1", "a.log.2.gz", "b.log-20261017.gz", "b.log-20261018.1", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.log"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	pattern := filepath.Join(dir, "*.log*")
+	inputs := ExpandInputs([]LogInput{
+		{Package: "zid-proxy", LogID: "daily", Path: pattern, Policy: InputPolicy{Naming: "date"}},
+		{Package: "zid-proxy", LogID: "main", Path: "/var/log/zid-proxy.log"},
+	}, config.RotateDefaults{})
+	if len(inputs) != 3 {
+		t.Fatalf("expected 3 inputs, got %d: %+v", len(inputs), inputs)
+	}
+	for _, input := range inputs[:2] {
+		if input.Pattern != pattern {
+			t.Fatalf("expected pattern preserved, got %q", input.Pattern)
+		}
+	}
+	if inputs[0].Path != filepath.Join(dir, "a.log") || inputs[1].Path != filepath.Join(dir, "b.log") {
+		t.Fatalf("unexpected matches: %s, %s", inputs[0].Path, inputs[1].Path)
+	}
+	if inputs[2].Pattern != "" {
+		t.Fatalf("plain input should not carry a pattern")
+	}
+}
+
+func TestExpandInputsSkipsRotationFiles(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"app.log", "app.log_2026-10-17", "app.log_2026-10-17.2.gz",
+		"other.log", "other.log@20261017.zst",
+		"app.log.1.gz.tmp.123456", "app.log_2026-10-18.tmp.42", ".app.log.cut",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	inputs := ExpandInputs([]LogInput{
+		{Package: "app", LogID: "main", Path: filepath.Join(dir, "app.log*"), Policy: InputPolicy{DateFormat: "_%Y-%m-%d"}},
+		{Package: "other", LogID: "main", Path: filepath.Join(dir, "other*")},
+		{Package: "hidden", LogID: "main", Path: filepath.Join(dir, ".*")},
+	}, config.RotateDefaults{DateFormat: "@%Y%m%d"})
+	var got []string
+	for _, input := range inputs {
+		got = append(got, filepath.Base(input.Path))
+	}
+	want := []string{"app.log", "other.log"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestExpandInputsKeepsLiveFilesEndingInDate(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"vpn-20261017", "vpn-20261018", "vpn-20261018.1", "vpn-20261018.2.gz", "vpn.log.7"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	inputs := ExpandInputs([]LogInput{
+		{Package: "vpn", LogID: "server", Path: filepath.Join(dir, "vpn*")},
+	}, config.RotateDefaults{})
+	var got []string
+	for _, input := range inputs {
+		got = append(got, filepath.Base(input.Path))
+	}
+	want := []string{"vpn-20261017", "vpn-20261018", "vpn.log.7"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestExpandInputsManagedTypes(t *testing.T) {
+	inputs := ExpandInputs([]LogInput{
+		{Package: "zid-fw", LogID: "pfctl", Type: "exec", Command: "pfctl -si"},
+		{Package: "legacy", LogID: "main", Type: "fifo", FifoPath: "/var/run/legacy.pipe", Path: "/var/log/legacy.log"},
+	}, config.RotateDefaults{})
+	if len(inputs) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(inputs))
+	}
+	if inputs[0].Path != filepath.Join("/var/log/zid-logs", "exec", "zid-fw", "pfctl.log") {
+		t.Fatalf("unexpected managed path %s", inputs[0].Path)
+	}
+	if inputs[0].TimestampLayout != ExecTimestampLayout {
+		t.Fatalf("expected exec timestamp layout")
+	}
+	if inputs[1].Path != "/var/log/legacy.log" {
+		t.Fatalf("explicit path should be kept")
+	}
+}
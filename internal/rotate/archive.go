@@ -0,0 +1,346 @@
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"zid-logs/internal/naming"
+)
+
+const (
+	NamingNumeric = naming.Numeric
+	NamingDate    = naming.Date
+
+	DefaultDateFormat = naming.DefaultDateFormat
+)
+
+var compressedExts = naming.CompressedExts
+
+// Archive e uma geracao rotacionada de um log. Index e a geracao no modo
+// numerico (0 no modo date); Time e o periodo do nome no modo date ou o mtime.
+type Archive struct {
+	Path       string    `json:"path"`
+	Index      int       `json:"index,omitempty"`
+	Time       time.Time `json:"time"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+
+	seq int
+}
+
+func (p Policy) dateNaming() bool {
+	return p.Naming == NamingDate
+}
+
+func (p Policy) dateFormat() string {
+	if p.DateFormat == "" {
+		return DefaultDateFormat
+	}
+	return p.DateFormat
+}
+
+// ValidateDateFormat aceita apenas %Y %m %d %H %M %S e texto sem separador de
+// diretorio.
+func ValidateDateFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	if strings.ContainsAny(format, "/*?[") {
+		return fmt.Errorf("date_format invalido: %s", format)
+	}
+	if _, err := naming.DateLayout(format); err != nil {
+		return err
+	}
+	return nil
+}
+
+// archiveSuffix retorna o sufixo de data do periodo, ex.: "-20261017".
+func archiveSuffix(policy Policy, period time.Time) string {
+	layout, err := naming.DateLayout(policy.dateFormat())
+	if err != nil {
+		layout, _ = naming.DateLayout(DefaultDateFormat)
+	}
+	return period.Format(layout)
+}
+
+// archiveBase retorna o caminho base das geracoes: o proprio log ou o mesmo
+// nome dentro de ArchiveDir (relativo ao diretorio do log quando nao absoluto).
+func archiveBase(path string, policy Policy) string {
+	if policy.ArchiveDir == "" {
+		return path
+	}
+	dir := policy.ArchiveDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+	return filepath.Join(dir, filepath.Base(path))
+}
+
+// ensureArchiveDir cria ArchiveDir com o modo e o dono do diretorio do log.
+func ensureArchiveDir(path string, policy Policy) error {
+	dir := filepath.Dir(archiveBase(path, policy))
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	perm := os.FileMode(0750)
+	parent, err := os.Stat(filepath.Dir(path))
+	if err == nil {
+		perm = parent.Mode().Perm()
+	}
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, perm); err != nil {
+		return err
+	}
+	if parent != nil {
+		if stat, ok := parent.Sys().(*syscall.Stat_t); ok {
+			_ = os.Chown(dir, int(stat.Uid), int(stat.Gid))
+		}
+	}
+	return nil
+}
+
+// newArchivePath retorna o destino da geracao mais nova. No modo date o nome
+// traz o periodo e recebe ".N" quando ja existe um arquivo do mesmo periodo.
+func newArchivePath(path string, policy Policy, period time.Time) string {
+	if !policy.dateNaming() {
+		return archiveBase(path, policy) + ".1"
+	}
+	base := archiveBase(path, policy) + archiveSuffix(policy, period)
+	candidate := base
+	for n := 1; archiveExists(candidate); n++ {
+		candidate = fmt.Sprintf("%s.%d", base, n)
+	}
+	return candidate
+}
+
+func archiveExists(path string) bool {
+	if _, err := os.Lstat(path); err == nil {
+		return true
+	}
+	for _, ext := range compressedExts {
+		if _, err := os.Lstat(path + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveArchive remove uma geracao fora da retencao da policy (disk_budget),
+// sem correr junto com a rotacao ou a compressao do log; se ela ja foi
+// comprimida, remove o arquivo comprimido. Retorna o arquivo removido e o
+// tamanho; false quando ele ja nao existe.
+func RemoveArchive(path string, policy Policy, archive string) (string, int64, bool, error) {
+	defer policy.Compressor.lockPath(path)()
+
+	file, size, ok := Locate(ArchiveName(archive))
+	if !ok {
+		return "", 0, false, nil
+	}
+	if err := os.Remove(file); err != nil {
+		if os.IsNotExist(err) {
+			return "", 0, false, nil
+		}
+		return "", 0, false, err
+	}
+	policy.catalogRemoved(file)
+	return file, size, true, nil
+}
+
+// Locate acha o arquivo rotacionado com o nome dado, comprimido ou nao.
+func Locate(archive string) (string, int64, bool) {
+	for _, ext := range append([]string{""}, compressedExts...) {
+		if info, err := os.Stat(archive + ext); err == nil {
+			return archive + ext, info.Size(), true
+		}
+	}
+	return "", 0, false
+}
+
+// periodBefore retorna o instante que identifica o periodo encerrado em cut.
+func periodBefore(cut time.Time) time.Time {
+	return cut.Add(-time.Second)
+}
+
+// ListArchives retorna as geracoes rotacionadas do log, da mais nova para a
+// mais antiga, reconhecendo tanto nomes numericos quanto por data.
+func ListArchives(path string, policy Policy) ([]Archive, error) {
+	dir := filepath.Dir(archiveBase(path, policy))
+	base := filepath.Base(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	layout, err := naming.DateLayout(policy.dateFormat())
+	if err != nil {
+		layout = ""
+	}
+
+	var archives []Archive
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		gen, ok := naming.Parse(base, name, layout)
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		archive := Archive{
+			Path:       filepath.Join(dir, name),
+			Index:      gen.Index,
+			Time:       info.ModTime(),
+			Size:       info.Size(),
+			Compressed: gen.Compressed,
+			seq:        gen.Seq,
+		}
+		if gen.Index == 0 {
+			archive.Time = gen.Period
+		}
+		archives = append(archives, archive)
+	}
+
+	sort.SliceStable(archives, func(i, j int) bool {
+		a, b := archives[i], archives[j]
+		if a.Index > 0 && b.Index > 0 {
+			return a.Index < b.Index
+		}
+		if !a.Time.Equal(b.Time) {
+			return a.Time.After(b.Time)
+		}
+		return a.seq > b.seq
+	})
+	return archives, nil
+}
+
+// FindArchive retorna a geracao que contem o instante at: no modo date pelo
+// periodo do nome; nos demais casos pela geracao mais antiga cujo mtime (fim
+// do periodo) nao e anterior a at.
+func FindArchive(path string, policy Policy, at time.Time) (Archive, bool, error) {
+	archives, err := ListArchives(path, policy)
+	if err != nil {
+		return Archive{}, false, err
+	}
+	if policy.dateNaming() {
+		want := archiveSuffix(policy, at)
+		for _, archive := range archives {
+			if archive.Index == 0 && archiveSuffix(policy, archive.Time) == want {
+				return archive, true, nil
+			}
+		}
+	}
+	var found Archive
+	ok := false
+	for _, archive := range archives {
+		if archive.Index == 0 && policy.dateNaming() {
+			continue
+		}
+		if !archive.Time.Before(at) {
+			found = archive
+			ok = true
+		}
+	}
+	return found, ok, nil
+}
+
+// lastGeneration retorna o maior indice numerico existente, usado com legal
+// hold para deslocar todas as geracoes sem sobrescrever a ultima.
+func lastGeneration(path string, policy Policy) int {
+	archives, err := ListArchives(path, policy)
+	if err != nil {
+		return 0
+	}
+	last := 0
+	for _, archive := range archives {
+		if archive.Index > last {
+			last = archive.Index
+		}
+	}
+	return last
+}
+
+// pruneArchives aplica a retencao: remove o que excede Keep, as geracoes mais
+// antigas que MaxArchiveAgeDays e as que passam de MaxArchiveTotalMB (a mais
+// nova sempre fica). Com LegalHold nada e removido.
+func pruneArchives(path string, policy Policy, now time.Time) error {
+	if policy.LegalHold {
+		return nil
+	}
+	archives, err := ListArchives(path, policy)
+	if err != nil {
+		return err
+	}
+	var cutoff time.Time
+	if policy.MaxArchiveAgeDays > 0 {
+		cutoff = now.AddDate(0, 0, -policy.MaxArchiveAgeDays)
+	}
+	maxTotal := int64(policy.MaxArchiveTotalMB) * 1024 * 1024
+	kept := 0
+	var total int64
+	for i, archive := range archives {
+		remove := !cutoff.IsZero() && archive.Time.Before(cutoff)
+		if archive.Index > policy.Keep {
+			remove = true
+		}
+		if policy.dateNaming() && archive.Index == 0 {
+			kept++
+			if kept > policy.Keep {
+				remove = true
+			}
+		}
+		if !remove && maxTotal > 0 && i > 0 && total+archive.Size > maxTotal {
+			remove = true
+		}
+		if !remove {
+			total += archive.Size
+			continue
+		}
+		if err := os.Remove(archive.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		policy.catalogRemoved(archive.Path)
+	}
+	return nil
+}
+
+// compressDateArchives comprime as geracoes por data; sem CompressNewest
+// (delay_compress) a mais nova fica sem compressao como o .1 do modo numerico.
+func compressDateArchives(path string, policy Policy) ([]CompressResult, error) {
+	archives, err := ListArchives(path, policy)
+	if err != nil {
+		return nil, err
+	}
+	var results []CompressResult
+	newest := !policy.CompressNewest
+	for _, archive := range archives {
+		if archive.Index > 0 {
+			continue
+		}
+		if newest {
+			newest = false
+			continue
+		}
+		if archive.Compressed {
+			continue
+		}
+		result, err := compressFile(archive.Path, policy)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,166 @@
+package rotate
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"zid-logs/internal/state"
+	"zid-logs/internal/timestamp"
+)
+
+// Catalog acompanha as geracoes rotacionadas de cada log. Os nomes sao sempre
+// sem a extensao de compressao; ArchiveAdded recebe o arquivo ja com o nome
+// final e roda dentro da rotacao, entao nao deve ler o arquivo. Describe
+// completa o resumo (Summarize) das geracoes de path que ainda nao o tem;
+// roda no worker do Compressor, quando houver, sempre antes da compressao.
+type Catalog interface {
+	ArchiveAdded(path, archive string)
+	ArchiveRenamed(from, to string)
+	ArchiveRemoved(archive string)
+	Describe(path string)
+}
+
+func (p Policy) catalogAdded(path, archive string) {
+	if p.Catalog != nil {
+		p.Catalog.ArchiveAdded(path, archive)
+	}
+}
+
+func (p Policy) catalogRenamed(from, to string) {
+	if p.Catalog != nil {
+		p.Catalog.ArchiveRenamed(from, to)
+	}
+}
+
+func (p Policy) catalogRemoved(file string) {
+	if p.Catalog != nil {
+		p.Catalog.ArchiveRemoved(ArchiveName(file))
+	}
+}
+
+func (p Policy) catalogDescribe(path string) {
+	if p.Catalog != nil {
+		p.Catalog.Describe(path)
+	}
+}
+
+// ArchiveName retira a extensao de compressao do arquivo rotacionado.
+func ArchiveName(file string) string {
+	for _, ext := range compressedExts {
+		if strings.HasSuffix(file, ext) {
+			return strings.TrimSuffix(file, ext)
+		}
+	}
+	return file
+}
+
+// Present filtra as entradas do catalogo cujas geracoes ainda existem,
+// preenchendo o arquivo atual e o tamanho comprimido, da mais nova para a
+// mais antiga.
+func Present(entries []state.ArchiveEntry) []state.ArchiveEntry {
+	var out []state.ArchiveEntry
+	for _, e := range entries {
+		file, size, ok := Locate(e.Name)
+		if !ok {
+			continue
+		}
+		e.File = file
+		if file != e.Name {
+			e.CompressedSize = size
+		}
+		out = append(out, e)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].RotatedAt > out[j].RotatedAt
+	})
+	return out
+}
+
+// Summary descreve o conteudo de um arquivo rotacionado.
+type Summary struct {
+	Size   int64
+	SHA256 string
+	First  time.Time
+	Last   time.Time
+}
+
+// summaryTail e o trecho final lido na procura do ultimo timestamp; dobra
+// ate achar uma linha com timestamp ou cobrir o arquivo.
+const summaryTail = 64 * 1024
+
+// Summarize calcula o SHA-256 do arquivo e, com parser, o primeiro e o ultimo
+// timestamp. So o comeco e o fim do arquivo sao interpretados.
+func Summarize(archive string, parser *timestamp.Parser) (Summary, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return Summary{}, err
+	}
+	summary := Summary{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+	if parser == nil {
+		return summary, nil
+	}
+
+	if _, ts, ok, err := parser.FirstAfter(file, 0, size); err != nil {
+		return summary, err
+	} else if ok {
+		summary.First = ts
+	}
+	for window := int64(summaryTail); ; window *= 2 {
+		from := size - window
+		if from < 0 {
+			from = 0
+		}
+		last, ok, err := lastTimestamp(file, from, size, parser)
+		if err != nil {
+			return summary, err
+		}
+		if ok || from == 0 {
+			summary.Last = last
+			break
+		}
+	}
+	return summary, nil
+}
+
+// lastTimestamp retorna o timestamp da ultima linha com timestamp entre as
+// que comecam depois de from.
+func lastTimestamp(file *os.File, from, size int64, parser *timestamp.Parser) (time.Time, bool, error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, from, size-from))
+	if from > 0 {
+		if _, err := reader.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return time.Time{}, false, err
+		}
+	}
+	var last time.Time
+	found := false
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if ts, ok := parser.Parse(line); ok {
+				last, found = ts, true
+			}
+		}
+		if err == io.EOF {
+			return last, found, nil
+		}
+		if err != nil {
+			return time.Time{}, false, err
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"zid-logs/internal/config"
+)
+
+const (
+	FormatGzip = config.CompressionGzip
+	FormatZstd = config.CompressionZstd
+	FormatXz   = config.CompressionXz
+)
+
+// compressResults e quantos resultados esperam a leitura de C; alem disso
+// eles sao descartados (a compressao em si nao e afetada).
+const compressResults = 64
+
+// CompressResult descreve um arquivo rotacionado comprimido.
+type CompressResult struct {
+	Path     string
+	Archive  string
+	Format   string
+	RawBytes int64
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+}
+
+// Ratio retorna quantas vezes o arquivo encolheu.
+func (r CompressResult) Ratio() float64 {
+	if r.Bytes <= 0 {
+		return 0
+	}
+	return float64(r.RawBytes) / float64(r.Bytes)
+}
+
+// ValidateCompressFormat confere compress_format e compress_level com o
+// mesmo validador de nivel do envio.
+func ValidateCompressFormat(format string, level int) error {
+	switch format {
+	case "":
+		format = FormatGzip
+	case FormatGzip, FormatZstd, FormatXz:
+	default:
+		return fmt.Errorf("compress_format invalido: %s", format)
+	}
+	if err := config.ValidateCompressLevel(format, level); err != nil {
+		return fmt.Errorf("compress_level: %w", err)
+	}
+	return nil
+}
+
+func (p Policy) compressExt() string {
+	switch p.CompressFormat {
+	case FormatZstd:
+		return ".zst"
+	case FormatXz:
+		return ".xz"
+	}
+	return ".gz"
+}
+
+func (p Policy) compressFormat() string {
+	if p.CompressFormat == "" {
+		return FormatGzip
+	}
+	return p.CompressFormat
+}
+
+// compressArchives comprime as geracoes ainda sem compressao do log.
+func compressArchives(path string, policy Policy) ([]CompressResult, error) {
+	if policy.dateNaming() {
+		return compressDateArchives(path, policy)
+	}
+	return compressRotated(path, policy)
+}
+
+func compressRotated(path string, policy Policy) ([]CompressResult, error) {
+	last := policy.Keep
+	if policy.LegalHold {
+		if n := lastGeneration(path, policy); n > last {
+			last = n
+		}
+	}
+	first := 2
+	if policy.CompressNewest {
+		first = 1
+	}
+	path = archiveBase(path, policy)
+	var results []CompressResult
+	for i := first; i <= last; i++ {
+		src := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(src); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return results, err
+		}
+
+		result, err := compressFile(src, policy)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func compressFile(path string, policy Policy) (CompressResult, error) {
+	result := CompressResult{Archive: path + policy.compressExt(), Format: policy.compressFormat()}
+	started := time.Now()
+
+	src, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return result, err
+	}
+	result.RawBytes = info.Size()
+
+	// comprime em um temporario e renomeia: um arquivo parcial nunca fica com
+	// o nome final
+	dst, err := os.CreateTemp(filepath.Dir(path), filepath.Base(result.Archive)+".tmp.*")
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	zw, err := newCompressWriter(dst, policy)
+	if err != nil {
+		return result, err
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = zw.Close()
+		return result, err
+	}
+	if err := zw.Close(); err != nil {
+		return result, err
+	}
+	if err := dst.Sync(); err != nil {
+		return result, err
+	}
+	if err := dst.Chmod(info.Mode().Perm()); err != nil {
+		return result, err
+	}
+	if packed, err := dst.Stat(); err == nil {
+		result.Bytes = packed.Size()
+	}
+	if err := os.Rename(dst.Name(), result.Archive); err != nil {
+		return result, err
+	}
+	if err := os.Remove(path); err != nil {
+		return result, err
+	}
+	result.Duration = time.Since(started)
+	return result, nil
+}
+
+func newCompressWriter(w io.Writer, policy Policy) (io.WriteCloser, error) {
+	switch policy.compressFormat() {
+	case FormatZstd:
+		var opts []zstd.EOption
+		if policy.CompressLevel > 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(policy.CompressLevel)))
+		}
+		return zstd.NewWriter(w, opts...)
+	case FormatXz:
+		return xz.NewWriter(w)
+	}
+	if policy.CompressLevel != 0 {
+		return gzip.NewWriterLevel(w, policy.CompressLevel)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// Compressor completa o catalogo e comprime os arquivos rotacionados em
+// segundo plano, fora do caminho da rotacao. Rotacao e compressao do mesmo
+// log nao correm juntas; cada arquivo comprimido gera um CompressResult em C.
+// A fila tem no maximo um trabalho por log: enfileirar um log que ainda
+// espera so atualiza a policy, entao nenhum pedido e perdido.
+type Compressor struct {
+	C <-chan CompressResult
+
+	results chan CompressResult
+	wake    chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	locks   map[string]*sync.Mutex
+	pending map[string]Policy
+	order   []string
+	stopped bool
+}
+
+func NewCompressor() *Compressor {
+	results := make(chan CompressResult, compressResults)
+	c := &Compressor{
+		C:       results,
+		results: results,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		locks:   make(map[string]*sync.Mutex),
+		pending: make(map[string]Policy),
+	}
+	go c.run()
+	return c
+}
+
+// Stop termina os trabalhos ja enfileirados e encerra o worker.
+func (c *Compressor) Stop() {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.stopped = true
+	c.mu.Unlock()
+	c.signal()
+	<-c.done
+}
+
+func (c *Compressor) enqueue(path string, policy Policy) {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	if _, ok := c.pending[path]; !ok {
+		c.order = append(c.order, path)
+	}
+	policy.Compressor = nil
+	c.pending[path] = policy
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *Compressor) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next espera o proximo log da fila; false depois de Stop com a fila vazia.
+func (c *Compressor) next() (string, Policy, bool) {
+	for {
+		c.mu.Lock()
+		if len(c.order) > 0 {
+			path := c.order[0]
+			c.order = c.order[1:]
+			policy := c.pending[path]
+			delete(c.pending, path)
+			c.mu.Unlock()
+			return path, policy, true
+		}
+		stopped := c.stopped
+		c.mu.Unlock()
+		if stopped {
+			return "", Policy{}, false
+		}
+		<-c.wake
+	}
+}
+
+// lockPath serializa rotacao e compressao do mesmo log; sem Compressor nao
+// ha nada a esperar.
+func (c *Compressor) lockPath(path string) func() {
+	if c == nil {
+		return func() {}
+	}
+	c.mu.Lock()
+	lock, ok := c.locks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.locks[path] = lock
+	}
+	c.mu.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+func (c *Compressor) run() {
+	defer close(c.done)
+	for {
+		path, policy, ok := c.next()
+		if !ok {
+			return
+		}
+
+		unlock := c.lockPath(path)
+		policy.catalogDescribe(path)
+		var results []CompressResult
+		var err error
+		if policy.Compress {
+			results, err = compressArchives(path, policy)
+		}
+		if err == nil {
+			err = pruneArchives(path, policy, time.Now())
+		}
+		unlock()
+
+		if err != nil {
+			results = append(results, CompressResult{Err: err})
+		}
+		for _, result := range results {
+			result.Path = path
+			select {
+			case c.results <- result:
+			default:
+			}
+		}
+	}
+}
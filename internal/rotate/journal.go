@@ -0,0 +1,281 @@
+package rotate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"zid-logs/internal/state"
+)
+
+const (
+	stepShift        = "shift"
+	stepMove         = "move"
+	stepCopyTruncate = "copytruncate"
+	stepCut          = "cut"
+	stepCompress     = "compress"
+)
+
+// Journal guarda o passo atual de cada rotacao (implementado por state.State).
+type Journal interface {
+	SaveRotation(state.Rotation) error
+	DeleteRotation(path string) error
+}
+
+func (p Policy) journal(r state.Rotation) error {
+	if p.Journal == nil {
+		return nil
+	}
+	return p.Journal.SaveRotation(r)
+}
+
+func (p Policy) journalDone(path string) error {
+	if p.Journal == nil {
+		return nil
+	}
+	return p.Journal.DeleteRotation(path)
+}
+
+// Recover conclui ou desfaz a rotacao interrompida descrita por r: uma
+// renumeracao pela metade e desfeita; mover, cortar e comprimir sao
+// concluidos. Temporarios de copia e compressao sao sempre descartados.
+func Recover(path string, policy Policy, r state.Rotation) error {
+	if err := removeTemps(path, policy); err != nil {
+		return err
+	}
+	switch r.Step {
+	case stepShift:
+		if err := undoShift(path, policy); err != nil {
+			return err
+		}
+		if r.Staged != "" && fileExists(r.Staged) {
+			if err := archiveStaged(path, policy, r); err != nil {
+				return err
+			}
+		}
+	case stepCut:
+		if fileExists(r.Staged) {
+			if err := resumeCut(path, r); err != nil {
+				return err
+			}
+			if err := archiveStaged(path, policy, r); err != nil {
+				return err
+			}
+		}
+	case stepMove:
+		if r.Staged != "" {
+			if err := moveFile(r.Staged, r.Archive); err != nil {
+				return err
+			}
+		} else if !fileExists(path) {
+			if info, err := os.Stat(r.Archive); err == nil {
+				if err := recreateFile(path, info); err != nil {
+					return err
+				}
+			}
+		}
+	case stepCopyTruncate:
+		if err := undoCopyTruncate(path, r.Archive); err != nil {
+			return err
+		}
+	}
+	return finishRotation(path, policy)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// removeTemps apaga temporarios deixados por copias e compressoes
+// interrompidas (nome.tmp.*), que nunca ficam com nome final.
+func removeTemps(path string, policy Policy) error {
+	dirs := []string{filepath.Dir(path), filepath.Dir(archiveBase(path, policy))}
+	for i, dir := range dirs {
+		if i > 0 && dir == dirs[0] {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, globEscape(filepath.Base(path))+"*.tmp.*"))
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func globEscape(name string) string {
+	var b bytes.Buffer
+	for _, c := range name {
+		switch c {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// undoShift desfaz uma renumeracao interrompida: as geracoes acima do
+// primeiro buraco voltam um indice.
+func undoShift(path string, policy Policy) error {
+	if policy.dateNaming() {
+		return nil
+	}
+	archives, err := ListArchives(path, policy)
+	if err != nil {
+		return err
+	}
+	present := make(map[int]bool)
+	last := 0
+	for _, archive := range archives {
+		present[archive.Index] = true
+		if archive.Index > last {
+			last = archive.Index
+		}
+	}
+	hole := 0
+	for i := 1; i <= last; i++ {
+		if !present[i] {
+			hole = i
+			break
+		}
+	}
+	if hole == 0 {
+		return nil
+	}
+	base := archiveBase(path, policy)
+	for i := hole + 1; i <= last; i++ {
+		src, dst := fmt.Sprintf("%s.%d", base, i), fmt.Sprintf("%s.%d", base, i-1)
+		existed := archiveExists(src)
+		for _, ext := range append([]string{""}, compressedExts...) {
+			if err := moveFile(src+ext, dst+ext); err != nil {
+				return err
+			}
+		}
+		if existed {
+			policy.catalogRenamed(src, dst)
+		}
+	}
+	return nil
+}
+
+// resumeCut garante que o trecho depois do corte esteja no log vivo e trunca
+// o arquivo antigo no corte. O que o log vivo ja tem do trecho nao e copiado
+// de novo.
+func resumeCut(path string, r state.Rotation) error {
+	old, err := os.OpenFile(r.Staged, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	if !fileExists(path) {
+		info, err := old.Stat()
+		if err != nil {
+			return err
+		}
+		if err := recreateFile(path, info); err != nil {
+			return err
+		}
+	}
+	live, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer live.Close()
+
+	matched, err := commonPrefix(io.NewSectionReader(old, r.CutOffset, 1<<62), live)
+	if err != nil {
+		return err
+	}
+	if _, err := appendLines(live, old, r.CutOffset+matched, true); err != nil {
+		return err
+	}
+	if err := live.Sync(); err != nil {
+		return err
+	}
+	return old.Truncate(r.CutOffset)
+}
+
+func commonPrefix(a, b io.Reader) (int64, error) {
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+	var n int64
+	for {
+		na, errA := io.ReadFull(a, bufA)
+		nb, errB := io.ReadFull(b, bufB[:na])
+		for i := 0; i < nb; i++ {
+			if bufA[i] != bufB[i] {
+				return n + int64(i), nil
+			}
+		}
+		n += int64(nb)
+		if nb < na || errA != nil || errB != nil {
+			if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+				return n, errA
+			}
+			return n, nil
+		}
+	}
+}
+
+// archiveStaged leva o arquivo antigo de um corte para o nome final.
+func archiveStaged(path string, policy Policy, r state.Rotation) error {
+	if err := ensureArchiveDir(path, policy); err != nil {
+		return err
+	}
+	if !policy.dateNaming() {
+		if err := shiftRotated(path, policy); err != nil {
+			return err
+		}
+	}
+	return moveFile(r.Staged, newArchivePath(path, policy, time.Unix(r.Period, 0)))
+}
+
+// undoCopyTruncate remove a copia quando o log ainda nao foi truncado (o log
+// vivo ainda comeca com o mesmo conteudo e e pelo menos do mesmo tamanho).
+func undoCopyTruncate(path, archive string) error {
+	copied, err := os.Open(archive)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer copied.Close()
+	live, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer live.Close()
+
+	ci, err := copied.Stat()
+	if err != nil {
+		return err
+	}
+	li, err := live.Stat()
+	if err != nil {
+		return err
+	}
+	if li.Size() < ci.Size() {
+		return nil
+	}
+	matched, err := commonPrefix(copied, live)
+	if err != nil {
+		return err
+	}
+	if matched < ci.Size() {
+		return nil
+	}
+	return os.Remove(archive)
+}
@@ -7,10 +7,20 @@ import (
 
 func ResolvePolicy(defaults config.RotateDefaults, input registry.InputPolicy) Policy {
 	policy := Policy{
-		MaxSizeMB:  defaults.MaxSizeMB,
-		Keep:       defaults.Keep,
-		Compress:   boolValue(defaults.Compress, true),
-		MaxAgeDays: 0,
+		MaxSizeMB:         defaults.MaxSizeMB,
+		Keep:              defaults.Keep,
+		Compress:          boolValue(defaults.Compress, true),
+		MaxAgeDays:        0,
+		Naming:            defaults.Naming,
+		DateFormat:        defaults.DateFormat,
+		MaxArchiveAgeDays: defaults.MaxArchiveAgeDays,
+		ArchiveDir:        defaults.ArchiveDir,
+		MaxArchiveTotalMB: defaults.MaxArchiveTotalMB,
+		LegalHold:         input.LegalHold,
+		Mode:              defaults.RotateMode,
+		CompressFormat:    defaults.CompressFormat,
+		CompressLevel:     defaults.CompressLevel,
+		CompressNewest:    !boolValue(defaults.DelayCompress, true),
 	}
 
 	if input.MaxSizeMB > 0 {
@@ -25,6 +35,33 @@ func ResolvePolicy(defaults config.RotateDefaults, input registry.InputPolicy) P
 	if input.MaxAgeDays > 0 {
 		policy.MaxAgeDays = input.MaxAgeDays
 	}
+	if input.Naming != "" {
+		policy.Naming = input.Naming
+	}
+	if input.DateFormat != "" {
+		policy.DateFormat = input.DateFormat
+	}
+	if input.MaxArchiveAgeDays > 0 {
+		policy.MaxArchiveAgeDays = input.MaxArchiveAgeDays
+	}
+	if input.ArchiveDir != "" {
+		policy.ArchiveDir = input.ArchiveDir
+	}
+	if input.CompressFormat != "" {
+		policy.CompressFormat = input.CompressFormat
+	}
+	if input.CompressLevel > 0 {
+		policy.CompressLevel = input.CompressLevel
+	}
+	if input.DelayCompress != nil {
+		policy.CompressNewest = !*input.DelayCompress
+	}
+	if input.RotateMode != "" {
+		policy.Mode = input.RotateMode
+	}
+	if input.MaxArchiveTotalMB > 0 {
+		policy.MaxArchiveTotalMB = input.MaxArchiveTotalMB
+	}
 
 	return policy
 }
@@ -1,41 +1,129 @@
 package rotate
 
 import (
-	"bufio"
-	"compress/gzip"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"syscall"
 	"time"
+
+	"zid-logs/internal/naming"
+	"zid-logs/internal/state"
+	"zid-logs/internal/timestamp"
+)
+
+const (
+	ModeRename       = "rename"
+	ModeCopyTruncate = "copytruncate"
+)
+
+// Motivos de uma rotacao, registrados no historico.
+const (
+	TriggerSize     = "size"
+	TriggerAge      = "age"
+	TriggerSchedule = "schedule"
+	TriggerForced   = "forced"
+	TriggerBudget   = "budget"
+)
+
+// copyTruncatePasses limita quantas vezes o copytruncate recopia bytes
+// gravados durante a copia antes de truncar.
+const copyTruncatePasses = 5
+
+// O corte parcial espera o arquivo antigo ficar um cutSettleInterval inteiro
+// sem crescer, por ate cutSettleRounds verificacoes.
+const (
+	cutSettleInterval = 100 * time.Millisecond
+	cutSettleRounds   = 20
 )
 
 type Policy struct {
-	MaxSizeMB  int
-	Keep       int
-	Compress   bool
-	MaxAgeDays int
+	MaxSizeMB         int
+	Keep              int
+	Compress          bool
+	MaxAgeDays        int
+	Naming            string
+	DateFormat        string
+	MaxArchiveAgeDays int
+	ArchiveDir        string
+	MaxArchiveTotalMB int
+	LegalHold         bool
+	Mode              string
+	Journal           Journal
+	CompressFormat    string
+	CompressLevel     int
+	CompressNewest    bool
+	Compressor        *Compressor
+	Hooks             Hooks
+	Catalog           Catalog
+}
+
+// errCutCopyTruncate recusa o corte por timestamp no copytruncate, que nao tem
+// onde manter o trecho posterior ao corte.
+var errCutCopyTruncate = errors.New("rotate_mode copytruncate nao aceita corte por timestamp")
+
+// ErrVetoed indica que o pre-rotate recusou a rotacao.
+var ErrVetoed = errors.New("rotacao vetada pelo pre_rotate")
+
+// Hooks e chamado em volta de cada rotacao com o instante do corte. PreRotate
+// recebe o nome que o arquivo rotacionado vai ter e um erro dele veta a
+// rotacao. PostRotate e o momento de o programa reabrir o log e recebe o
+// arquivo que guarda o periodo naquele instante: o rotacionado, ainda sem
+// compressao, ou no corte parcial o arquivo de preparo (.nome.cut).
+type Hooks interface {
+	PreRotate(archive string, cut time.Time) error
+	PostRotate(archive string, cut time.Time)
+}
+
+func (p Policy) preRotate(archive string, cut time.Time) error {
+	if p.Hooks == nil {
+		return nil
+	}
+	if err := p.Hooks.PreRotate(archive, cut); err != nil {
+		return fmt.Errorf("%w: %v", ErrVetoed, err)
+	}
+	return nil
+}
+
+func (p Policy) postRotate(archive string, cut time.Time) {
+	if p.Hooks != nil {
+		p.Hooks.PostRotate(archive, cut)
+	}
+}
+
+func (p Policy) copyTruncate() bool {
+	return p.Mode == ModeCopyTruncate
+}
+
+func ValidateMode(mode string) error {
+	switch mode {
+	case "", ModeRename, ModeCopyTruncate:
+		return nil
+	}
+	return fmt.Errorf("rotate_mode invalido: %s", mode)
 }
 
 func RotateIfNeeded(path string, policy Policy) (bool, error) {
+	defer policy.Compressor.lockPath(path)()
+
 	info, err := os.Stat(path)
 	if err != nil {
 		return false, err
 	}
 
-	if !shouldRotate(info, policy) {
+	if Due(info, policy) == "" {
 		return false, nil
 	}
 
-	if err := rotateFile(path, info, policy); err != nil {
-		return false, err
-	}
-
-	return true, nil
+	return rotateWhole(path, info, policy, time.Now(), time.Now())
 }
 
 func ForceRotate(path string, policy Policy) (bool, error) {
+	defer policy.Compressor.lockPath(path)()
+
 	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -44,14 +132,30 @@ func ForceRotate(path string, policy Policy) (bool, error) {
 		return false, err
 	}
 
-	if err := rotateFile(path, info, policy); err != nil {
+	return rotateWhole(path, info, policy, time.Now(), time.Now())
+}
+
+// rotateWhole rotaciona o arquivo inteiro entre os hooks.
+func rotateWhole(path string, info os.FileInfo, policy Policy, period, cut time.Time) (bool, error) {
+	archive := newArchivePath(path, policy, period)
+	if err := policy.preRotate(archive, cut); err != nil {
+		return false, err
+	}
+	if err := rotateFile(path, info, policy, period, cut); err != nil {
 		return false, err
 	}
-
 	return true, nil
 }
 
-func RotateByTimestampCut(path string, policy Policy, layout string, cutoff time.Time) (bool, error) {
+// RotateByTimestampCut rotaciona as linhas anteriores a cutoff. No corte
+// parcial o PostRotate dos Hooks acontece antes de recolher o que ainda foi
+// gravado no arquivo antigo. Com copytruncate o corte e recusado.
+func RotateByTimestampCut(path string, policy Policy, parser *timestamp.Parser, cutoff time.Time) (bool, error) {
+	if parser == nil {
+		return ForceRotate(path, policy)
+	}
+	defer policy.Compressor.lockPath(path)()
+
 	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -59,11 +163,11 @@ func RotateByTimestampCut(path string, policy Policy, layout string, cutoff time
 		}
 		return false, err
 	}
-	if layout == "" {
-		return ForceRotate(path, policy)
-	}
 
-	cutOffset, err := findCutOffset(path, layout, cutoff)
+	if policy.copyTruncate() {
+		return false, errCutCopyTruncate
+	}
+	cutOffset, err := findCutOffset(path, parser, cutoff)
 	if err != nil {
 		return false, err
 	}
@@ -71,184 +175,293 @@ func RotateByTimestampCut(path string, policy Policy, layout string, cutoff time
 		return false, nil
 	}
 	if cutOffset >= info.Size() {
-		return ForceRotate(path, policy)
+		return rotateWhole(path, info, policy, periodBefore(cutoff), cutoff)
 	}
 
-	return rotateByOffset(path, info, policy, cutOffset)
+	return rotateByCut(path, info, policy, cutOffset, periodBefore(cutoff), cutoff)
 }
 
-func shouldRotate(info os.FileInfo, policy Policy) bool {
+// Due retorna o motivo (TriggerSize ou TriggerAge) pelo qual o log deve ser
+// rotacionado, ou vazio.
+func Due(info os.FileInfo, policy Policy) string {
 	if policy.MaxSizeMB > 0 {
 		if info.Size() >= int64(policy.MaxSizeMB)*1024*1024 {
-			return true
+			return TriggerSize
 		}
 	}
 	if policy.MaxAgeDays > 0 {
 		maxAge := time.Duration(policy.MaxAgeDays) * 24 * time.Hour
 		if time.Since(info.ModTime()) >= maxAge {
-			return true
+			return TriggerAge
 		}
 	}
-	return false
+	return ""
 }
 
-func rotateFile(path string, info os.FileInfo, policy Policy) error {
+func rotateFile(path string, info os.FileInfo, policy Policy, period, cut time.Time) error {
 	if policy.Keep < 1 {
 		return nil
 	}
 
-	if err := shiftRotated(path, policy); err != nil {
+	plan := state.Rotation{Path: path, Period: period.Unix()}
+	if err := ensureArchiveDir(path, policy); err != nil {
 		return err
 	}
+	if !policy.dateNaming() {
+		plan.Step = stepShift
+		if err := policy.journal(plan); err != nil {
+			return err
+		}
+		if err := shiftRotated(path, policy); err != nil {
+			return err
+		}
+	}
 
-	if err := moveFile(path, fmt.Sprintf("%s.1", path)); err != nil {
-		return err
+	plan.Archive = newArchivePath(path, policy, period)
+	if policy.copyTruncate() {
+		plan.Step = stepCopyTruncate
+		if err := policy.journal(plan); err != nil {
+			return err
+		}
+		if err := copyTruncate(path, plan.Archive); err != nil {
+			return err
+		}
+		policy.catalogAdded(path, plan.Archive)
+	} else {
+		plan.Step = stepMove
+		if err := policy.journal(plan); err != nil {
+			return err
+		}
+		if err := moveFile(path, plan.Archive); err != nil {
+			return err
+		}
+		if err := recreateFile(path, info); err != nil {
+			return err
+		}
+		policy.catalogAdded(path, plan.Archive)
 	}
+	policy.postRotate(plan.Archive, cut)
 
-	if err := recreateFile(path, info); err != nil {
+	plan.Step = stepCompress
+	if err := policy.journal(plan); err != nil {
 		return err
 	}
+	if err := finishRotation(path, policy); err != nil {
+		return err
+	}
+	return policy.journalDone(path)
+}
 
+// finishRotation completa o catalogo, comprime as geracoes antigas e aplica a
+// retencao. Com Compressor tudo fica para o worker em segundo plano.
+func finishRotation(path string, policy Policy) error {
+	if policy.Compressor != nil && (policy.Compress || policy.Catalog != nil) {
+		policy.Compressor.enqueue(path, policy)
+		return nil
+	}
+	policy.catalogDescribe(path)
 	if policy.Compress {
-		if err := compressRotated(path, policy); err != nil {
+		if _, err := compressArchives(path, policy); err != nil {
 			return err
 		}
 	}
-
-	return nil
+	return pruneArchives(path, policy, time.Now())
 }
 
-func rotateByOffset(path string, info os.FileInfo, policy Policy, cutOffset int64) (bool, error) {
+// rotateByCut corta o log em cutOffset sem perder linhas gravadas durante a
+// rotacao: o arquivo e renomeado primeiro e o trecho depois do corte vai para
+// um arquivo novo no caminho original. Com ou sem PostRotate, o que o programa
+// ainda grava no arquivo antigo tambem e copiado (settleCut); por fim o antigo
+// e truncado no corte e vira o arquivo rotacionado.
+func rotateByCut(path string, info os.FileInfo, policy Policy, cutOffset int64, period, cut time.Time) (bool, error) {
 	if policy.Keep < 1 {
 		return false, nil
 	}
-	dir := filepath.Dir(path)
-	base := filepath.Base(path)
-
-	rotateTmp, err := os.CreateTemp(dir, base+".rotate.*")
-	if err != nil {
+	archive := newArchivePath(path, policy, period)
+	if err := policy.preRotate(archive, cut); err != nil {
 		return false, err
 	}
-	defer os.Remove(rotateTmp.Name())
-
-	remainTmp, err := os.CreateTemp(dir, base+".remain.*")
-	if err != nil {
-		rotateTmp.Close()
+	staged := naming.Staged(path)
+	plan := state.Rotation{Path: path, Step: stepCut, Staged: staged, CutOffset: cutOffset, Period: period.Unix()}
+	if err := policy.journal(plan); err != nil {
 		return false, err
 	}
-	defer os.Remove(remainTmp.Name())
-
-	src, err := os.Open(path)
-	if err != nil {
-		rotateTmp.Close()
-		remainTmp.Close()
+	if err := os.Rename(path, staged); err != nil {
 		return false, err
 	}
-	defer src.Close()
-
-	if _, err := io.CopyN(rotateTmp, src, cutOffset); err != nil && err != io.EOF {
-		rotateTmp.Close()
-		remainTmp.Close()
-		return false, err
-	}
-	if _, err := io.Copy(remainTmp, src); err != nil {
-		rotateTmp.Close()
-		remainTmp.Close()
+	if err := recreateFile(path, info); err != nil {
 		return false, err
 	}
 
-	if err := rotateTmp.Close(); err != nil {
-		remainTmp.Close()
+	old, err := os.OpenFile(staged, os.O_RDWR, 0)
+	if err != nil {
 		return false, err
 	}
-	if err := remainTmp.Close(); err != nil {
+	defer old.Close()
+	live, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
 		return false, err
 	}
+	defer live.Close()
 
-	if err := os.Chmod(rotateTmp.Name(), info.Mode().Perm()); err != nil {
+	copied, err := appendLines(live, old, cutOffset, false)
+	if err != nil {
 		return false, err
 	}
-	if err := os.Chmod(remainTmp.Name(), info.Mode().Perm()); err != nil {
+	policy.postRotate(staged, cut)
+	if err := settleCut(live, old, cutOffset, copied); err != nil {
 		return false, err
 	}
-	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
-		_ = os.Chown(rotateTmp.Name(), int(stat.Uid), int(stat.Gid))
-		_ = os.Chown(remainTmp.Name(), int(stat.Uid), int(stat.Gid))
+	if err := old.Close(); err != nil {
+		return false, err
 	}
 
-	if err := shiftRotated(path, policy); err != nil {
+	if err := ensureArchiveDir(path, policy); err != nil {
 		return false, err
 	}
-
-	if err := moveFile(rotateTmp.Name(), fmt.Sprintf("%s.1", path)); err != nil {
+	if !policy.dateNaming() {
+		plan.Step = stepShift
+		if err := policy.journal(plan); err != nil {
+			return false, err
+		}
+		if err := shiftRotated(path, policy); err != nil {
+			return false, err
+		}
+	}
+	plan.Step = stepMove
+	plan.Archive = newArchivePath(path, policy, period)
+	if err := policy.journal(plan); err != nil {
 		return false, err
 	}
-	if err := moveFile(remainTmp.Name(), path); err != nil {
+	if err := moveFile(staged, plan.Archive); err != nil {
 		return false, err
 	}
+	policy.catalogAdded(path, plan.Archive)
 
-	if policy.Compress {
-		if err := compressRotated(path, policy); err != nil {
-			return false, err
-		}
+	plan.Step = stepCompress
+	if err := policy.journal(plan); err != nil {
+		return false, err
+	}
+	if err := finishRotation(path, policy); err != nil {
+		return false, err
 	}
 
-	return true, nil
+	return true, policy.journalDone(path)
 }
 
-func findCutOffset(path string, layout string, cutoff time.Time) (int64, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return 0, err
+// settleCut copia para o log vivo o que ainda chega no arquivo antigo e so o
+// trunca no corte depois de um intervalo inteiro sem crescer. O que for
+// gravado depois do truncamento (O_APPEND grava a partir do corte) tambem e
+// copiado antes de truncar de novo. Se o arquivo nunca estabiliza, ele nao e
+// truncado: o arquivo rotacionado fica com o que veio depois do corte, parte
+// tambem copiada para o log vivo, mas nada se perde.
+func settleCut(live, old *os.File, cutOffset, copied int64) error {
+	lastSize := int64(-1)
+	for round := 0; round < cutSettleRounds; round++ {
+		time.Sleep(cutSettleInterval)
+		next, err := appendLines(live, old, copied, false)
+		if err != nil {
+			return err
+		}
+		size, err := fileSize(old)
+		if err != nil {
+			return err
+		}
+		if next == copied && size > next && size == lastSize {
+			// linha incompleta parada ha um intervalo: vai assim mesmo
+			if next, err = appendLines(live, old, copied, true); err != nil {
+				return err
+			}
+		}
+		if next != copied || size != next {
+			copied, lastSize = next, size
+			continue
+		}
+		if err := live.Sync(); err != nil {
+			return err
+		}
+		if err := old.Truncate(cutOffset); err != nil {
+			return err
+		}
+		if size, err = fileSize(old); err != nil {
+			return err
+		}
+		if size == cutOffset {
+			return nil
+		}
+		copied = cutOffset
 	}
-	defer file.Close()
+	return live.Sync()
+}
 
-	reader := bufio.NewReader(file)
-	var offset int64
+// appendLines acrescenta em dst o conteudo de src a partir de offset, uma
+// escrita por bloco de linhas inteiras, para nao intercalar pedacos de linha
+// com quem grava no log vivo; sem all a ultima linha incompleta fica para a
+// proxima chamada. Retorna o novo offset lido.
+func appendLines(dst, src *os.File, offset int64, all bool) (int64, error) {
+	buf := make([]byte, 32*1024)
 	for {
-		line, err := reader.ReadString('\n')
-		if line != "" {
-			if ts, ok := parseLineTimestamp(line, layout); ok {
-				if !ts.Before(cutoff) {
-					return offset, nil
-				}
-			}
-			offset += int64(len(line))
+		n, err := src.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return offset, err
 		}
-		if err == io.EOF {
-			break
+		eof := err == io.EOF
+		chunk := buf[:n]
+		// uma linha maior que o buffer vai em pedacos
+		if eof && !all || !eof && bytes.IndexByte(chunk, '\n') >= 0 {
+			chunk = chunk[:bytes.LastIndexByte(chunk, '\n')+1]
 		}
-		if err != nil {
-			return 0, err
+		if len(chunk) > 0 {
+			if _, err := dst.Write(chunk); err != nil {
+				return offset, err
+			}
+			offset += int64(len(chunk))
+		}
+		if eof {
+			return offset, nil
 		}
 	}
+}
 
+func fileSize(file *os.File) (int64, error) {
 	info, err := file.Stat()
 	if err != nil {
-		return offset, nil
+		return 0, err
 	}
 	return info.Size(), nil
 }
 
-func parseLineTimestamp(line string, layout string) (time.Time, bool) {
-	if len(line) < len(layout) {
-		return time.Time{}, false
+// findCutOffset retorna o offset da primeira linha com timestamp >= cutoff
+// (ou o tamanho do arquivo), por busca binaria.
+func findCutOffset(path string, parser *timestamp.Parser, cutoff time.Time) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
 	}
-	prefix := line[:len(layout)]
-	ts, err := time.ParseInLocation(layout, prefix, time.Local)
+	defer file.Close()
+
+	info, err := file.Stat()
 	if err != nil {
-		return time.Time{}, false
+		return 0, err
 	}
-	return ts, true
+	return parser.FindOffset(file, 0, info.Size(), cutoff)
 }
 
 func shiftRotated(path string, policy Policy) error {
-	for i := policy.Keep - 1; i >= 1; i-- {
+	top := policy.Keep - 1
+	if policy.LegalHold {
+		if last := lastGeneration(path, policy); last > top {
+			top = last
+		}
+	}
+	path = archiveBase(path, policy)
+	for i := top; i >= 1; i-- {
 		src := fmt.Sprintf("%s.%d", path, i)
 		dst := fmt.Sprintf("%s.%d", path, i+1)
+		existed := archiveExists(src)
 
-		if policy.Compress && i >= 2 {
-			if err := moveFile(src+".gz", dst+".gz"); err != nil {
+		for _, ext := range compressedExts {
+			if err := moveFile(src+ext, dst+ext); err != nil {
 				return err
 			}
 		}
@@ -256,6 +469,9 @@ func shiftRotated(path string, policy Policy) error {
 		if err := moveFile(src, dst); err != nil {
 			return err
 		}
+		if existed {
+			policy.catalogRenamed(src, dst)
+		}
 	}
 
 	return nil
@@ -270,74 +486,147 @@ func moveFile(src, dst string) error {
 	}
 
 	_ = os.Remove(dst)
-	return os.Rename(src, dst)
+	err := os.Rename(src, dst)
+	if errors.Is(err, syscall.EXDEV) {
+		return copyAcross(src, dst)
+	}
+	return err
 }
 
-func recreateFile(path string, info os.FileInfo) error {
-	perm := info.Mode().Perm()
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+// copyAcross move src para outro sistema de arquivos: copia para um temp no
+// destino, faz fsync, renomeia e so entao remove a origem.
+func copyAcross(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
 		return err
 	}
-
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	defer in.Close()
+	info, err := in.Stat()
 	if err != nil {
 		return err
 	}
-	if err := file.Close(); err != nil {
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp.*")
+	if err != nil {
 		return err
 	}
+	defer os.Remove(tmp.Name())
 
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
 	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
-		_ = os.Chown(path, int(stat.Uid), int(stat.Gid))
+		_ = os.Chown(tmp.Name(), int(stat.Uid), int(stat.Gid))
 	}
-
-	return nil
+	_ = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(dst))
+	return os.Remove(src)
 }
 
-func compressRotated(path string, policy Policy) error {
-	for i := 2; i <= policy.Keep; i++ {
-		src := fmt.Sprintf("%s.%d", path, i)
-		if _, err := os.Stat(src); err != nil {
-			if os.IsNotExist(err) {
-				continue
-			}
+// copyTruncate copia o log para dst e o trunca no lugar, para programas que
+// nunca reabrem o arquivo. A copia e repetida enquanto o arquivo cresce; o
+// destino recebe o nome final antes do truncamento e uma ultima copia pelo
+// mesmo descritor pega o que chegou nesse meio tempo. Bytes gravados entre
+// essa ultima copia e o truncamento ainda podem se perder.
+func copyTruncate(path, dst string) error {
+	src, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp.*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	defer tmp.Close()
+
+	var copied int64
+	for pass := 0; pass < copyTruncatePasses; pass++ {
+		n, err := io.Copy(tmp, io.NewSectionReader(src, copied, 1<<62))
+		if err != nil {
 			return err
 		}
-
-		if err := compressFile(src); err != nil {
+		copied += n
+		cur, err := src.Stat()
+		if err != nil {
 			return err
 		}
+		if cur.Size() <= copied {
+			break
+		}
 	}
-	return nil
-}
 
-func compressFile(path string) error {
-	src, err := os.Open(path)
-	if err != nil {
+	if err := os.Chmod(tmpName, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Chown(tmpName, int(stat.Uid), int(stat.Gid))
+	}
+	_ = os.Remove(dst)
+	if err := os.Rename(tmpName, dst); err != nil {
 		return err
 	}
-	defer src.Close()
 
-	info, err := src.Stat()
-	if err != nil {
+	if _, err := io.Copy(tmp, io.NewSectionReader(src, copied, 1<<62)); err != nil {
 		return err
 	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := src.Truncate(0); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(dst))
+	return tmp.Close()
+}
 
-	dstPath := path + ".gz"
-	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+func syncDir(dir string) {
+	d, err := os.Open(dir)
 	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+func recreateFile(path string, info os.FileInfo) error {
+	perm := info.Mode().Perm()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
-	defer dst.Close()
 
-	zw := gzip.NewWriter(dst)
-	if _, err := io.Copy(zw, src); err != nil {
-		_ = zw.Close()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
 		return err
 	}
-	if err := zw.Close(); err != nil {
+	if err := file.Close(); err != nil {
 		return err
 	}
 
-	return os.Remove(path)
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Chown(path, int(stat.Uid), int(stat.Gid))
+	}
+
+	return nil
 }
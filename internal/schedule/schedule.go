@@ -0,0 +1,333 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/registry"
+)
+
+// maxSearch limita a busca do proximo disparo (expressoes impossiveis como
+// 30 de fevereiro nunca disparam).
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Schedule e uma expressao cron de 5 campos (minuto hora dia mes dia-da-semana)
+// avaliada no fuso da agenda (horario local por padrao).
+type Schedule struct {
+	spec    string
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+	loc     *time.Location
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse aceita expressao cron, macros (@daily, @weekly, @monthly...) ou o
+// formato legado HH:MM do rotate_at (diario).
+func Parse(spec string) (*Schedule, error) {
+	return ParseIn(spec, time.Local)
+}
+
+// ParseIn interpreta a agenda no fuso loc.
+func ParseIn(spec string, loc *time.Location) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("agenda vazia")
+	}
+	expr := spec
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		expr = macro
+	} else if !strings.Contains(spec, " ") {
+		hour, minute, err := parseClock(spec)
+		if err != nil {
+			return nil, err
+		}
+		expr = fmt.Sprintf("%d %d * * *", minute, hour)
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("agenda invalida %q: esperado 5 campos", spec)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	s := &Schedule{spec: spec, loc: loc}
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("agenda invalida %q: minuto: %w", spec, err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("agenda invalida %q: hora: %w", spec, err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("agenda invalida %q: dia: %w", spec, err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("agenda invalida %q: mes: %w", spec, err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("agenda invalida %q: dia da semana: %w", spec, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// Next retorna o primeiro disparo estritamente depois de t, ou zero se nao
+// houver disparo no horizonte de busca. Horarios que caem no salto do horario
+// de verao disparam no primeiro instante apos o salto; horarios repetidos no
+// fim do horario de verao disparam apenas na primeira ocorrencia.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case !has(s.month, int(t.Month())):
+			next = startOfDay(t.Year(), t.Month()+1, 1, s.loc)
+		case !s.dayMatches(t):
+			next = startOfDay(t.Year(), t.Month(), t.Day()+1, s.loc)
+		case !has(s.hour, t.Hour()):
+			next = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case !has(s.minute, t.Minute()) || !firstOccurrence(t):
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if !next.After(t) {
+			next = t.Add(time.Hour)
+		}
+		if s.firesInGap(t, next) {
+			return next
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+// Prev retorna o ultimo disparo em t ou antes dele, ou zero se nao houver
+// disparo no horizonte de busca. Segue as mesmas regras de Next para o
+// horario de verao.
+func (s *Schedule) Prev(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute)
+	limit := t.Add(-maxSearch)
+	for t.After(limit) {
+		var prev time.Time
+		switch {
+		case !has(s.month, int(t.Month())):
+			prev = startOfDay(t.Year(), t.Month(), 1, s.loc).Add(-time.Minute)
+		case !s.dayMatches(t):
+			prev = startOfDay(t.Year(), t.Month(), t.Day(), s.loc).Add(-time.Minute)
+		case !has(s.hour, t.Hour()):
+			prev = t.Add(-time.Duration(t.Minute()+1) * time.Minute)
+		case !has(s.minute, t.Minute()) || !firstOccurrence(t):
+			prev = t.Add(-time.Minute)
+		default:
+			return t
+		}
+		if !prev.Before(t) {
+			prev = t.Add(-time.Minute)
+		}
+		if s.firesInGap(prev, t) {
+			return prev.Add(time.Minute)
+		}
+		t = prev
+	}
+	return time.Time{}
+}
+
+// Between retorna os disparos em (after, until], no maximo limit, mantendo os
+// mais recentes quando houver mais.
+func (s *Schedule) Between(after, until time.Time, limit int) []time.Time {
+	var out []time.Time
+	for t := s.Next(after); !t.IsZero() && !t.After(until); t = s.Next(t) {
+		out = append(out, t)
+		if limit > 0 && len(out) > limit {
+			out = out[1:]
+		}
+	}
+	return out
+}
+
+// firesInGap indica se algum horario da agenda caiu no intervalo de relogio
+// pulado entre from e to (inicio do horario de verao).
+func (s *Schedule) firesInGap(from, to time.Time) bool {
+	wf, wt := wallClock(from), wallClock(to)
+	if wt.Sub(wf) <= to.Sub(from) {
+		return false
+	}
+	for w := wf.Add(time.Minute); w.Before(wt); w = w.Add(time.Minute) {
+		if has(s.month, int(w.Month())) && s.dayMatches(w) && has(s.hour, w.Hour()) && has(s.minute, w.Minute()) {
+			return true
+		}
+	}
+	return false
+}
+
+// wallClock representa o horario de relogio de t em UTC, para comparar
+// horarios locais sem influencia do offset.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// firstOccurrence e falso para a segunda passagem de um horario repetido no
+// fim do horario de verao.
+func firstOccurrence(t time.Time) bool {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location()).Equal(t)
+}
+
+// startOfDay retorna o primeiro instante do dia, que nao e meia-noite quando o
+// horario de verao comeca a 00:00.
+func startOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	noon := time.Date(year, month, day, 12, 0, 0, 0, loc)
+	t := time.Date(noon.Year(), noon.Month(), noon.Day(), 0, 0, 0, 0, loc)
+	for t.Day() != noon.Day() {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
+
+// dayMatches segue o cron classico: com dia do mes e dia da semana restritos,
+// basta um deles casar.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, stepText, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("passo invalido %q", part)
+			}
+			step = n
+			part = base
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			a, b, _ := strings.Cut(part, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("valor invalido %q", part)
+			}
+			if hi, err = strconv.Atoi(b); err != nil {
+				return 0, fmt.Errorf("valor invalido %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("valor invalido %q", part)
+			}
+			lo = n
+			if step == 1 {
+				hi = n
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("fora do intervalo %d-%d: %q", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func parseClock(value string) (int, int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("rotate_at invalido")
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("hora invalida")
+	}
+	minute := 0
+	if len(parts) == 2 {
+		minute, err = strconv.Atoi(parts[1])
+		if err != nil || minute < 0 || minute > 59 {
+			return 0, 0, fmt.Errorf("minuto invalido")
+		}
+	}
+	return hour, minute, nil
+}
+
+// For resolve a agenda de rotacao do input: rotate_schedule do input, depois
+// rotate_schedule global e por fim rotate_at, no fuso rotate_timezone do
+// input ou global. Retorna nil quando a rotacao do input segue apenas
+// interval_rotate_seconds.
+func For(cfg config.Config, input registry.LogInput) (*Schedule, error) {
+	spec := input.RotateSchedule
+	if spec == "" {
+		spec = cfg.RotateSchedule
+	}
+	if spec == "" {
+		spec = cfg.RotateAt
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	tz := input.RotateTimezone
+	if tz == "" {
+		tz = cfg.RotateTimezone
+	}
+	loc, err := LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIn(spec, loc)
+}
+
+// LoadLocation carrega o fuso da agenda; vazio ou "Local" usa o fuso do sistema.
+func LoadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "Local" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("rotate_timezone invalido %q: %w", name, err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,158 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/registry"
+)
+
+func TestNextAndPrev(t *testing.T) {
+	loc := time.UTC
+	base := time.Date(2026, 1, 20, 10, 30, 0, 0, loc) // terca-feira
+
+	cases := []struct {
+		spec string
+		next time.Time
+		prev time.Time
+	}{
+		{"00:00", time.Date(2026, 1, 21, 0, 0, 0, 0, loc), time.Date(2026, 1, 20, 0, 0, 0, 0, loc)},
+		{"10:30", time.Date(2026, 1, 21, 10, 30, 0, 0, loc), time.Date(2026, 1, 20, 10, 30, 0, 0, loc)},
+		{"0 */6 * * *", time.Date(2026, 1, 20, 12, 0, 0, 0, loc), time.Date(2026, 1, 20, 6, 0, 0, 0, loc)},
+		{"@weekly", time.Date(2026, 1, 25, 0, 0, 0, 0, loc), time.Date(2026, 1, 18, 0, 0, 0, 0, loc)},
+		{"@monthly", time.Date(2026, 2, 1, 0, 0, 0, 0, loc), time.Date(2026, 1, 1, 0, 0, 0, 0, loc)},
+		{"15 3 1,15 * *", time.Date(2026, 2, 1, 3, 15, 0, 0, loc), time.Date(2026, 1, 15, 3, 15, 0, 0, loc)},
+		{"0 0 * * 1-5", time.Date(2026, 1, 21, 0, 0, 0, 0, loc), time.Date(2026, 1, 20, 0, 0, 0, 0, loc)},
+	}
+	for _, tc := range cases {
+		s, err := Parse(tc.spec)
+		if err != nil {
+			t.Fatalf("%q: parse error: %v", tc.spec, err)
+		}
+		if got := s.Next(base); !got.Equal(tc.next) {
+			t.Fatalf("%q: expected next %s, got %s", tc.spec, tc.next, got)
+		}
+		if got := s.Prev(base); !got.Equal(tc.prev) {
+			t.Fatalf("%q: expected prev %s, got %s", tc.spec, tc.prev, got)
+		}
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"", "25:00", "0 0 * *", "61 * * * *", "0 0 32 * *", "*/0 * * * *", "x y z w v"} {
+		if _, err := Parse(spec); err == nil {
+			t.Fatalf("%q: expected error", spec)
+		}
+	}
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Fatalf("expected no fire time for 30/feb, got %s", next)
+	}
+}
+
+func TestForResolvesPerInputThenGlobal(t *testing.T) {
+	cfg := config.Config{RotateAt: "02:00"}
+	s, err := For(cfg, registry.LogInput{})
+	if err != nil || s == nil || s.String() != "02:00" {
+		t.Fatalf("expected rotate_at fallback, got %v %v", s, err)
+	}
+	cfg.RotateSchedule = "@weekly"
+	if s, _ := For(cfg, registry.LogInput{}); s.String() != "@weekly" {
+		t.Fatalf("expected global rotate_schedule, got %s", s)
+	}
+	if s, _ := For(cfg, registry.LogInput{RotateSchedule: "0 */6 * * *"}); s.String() != "0 */6 * * *" {
+		t.Fatalf("expected input rotate_schedule, got %s", s)
+	}
+	if s, err := For(config.Config{}, registry.LogInput{}); s != nil || err != nil {
+		t.Fatalf("expected no schedule, got %v %v", s, err)
+	}
+}
+
+func TestDaylightSavingTransitions(t *testing.T) {
+	ny, err := LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tzdata indisponivel: %v", err)
+	}
+
+	daily, _ := ParseIn("00:30", ny)
+	before := time.Date(2026, 3, 7, 12, 0, 0, 0, ny)
+	first := daily.Next(before)
+	second := daily.Next(first)
+	if first.Hour() != 0 || first.Minute() != 30 || second.Hour() != 0 || second.Minute() != 30 {
+		t.Fatalf("expected 00:30 on both days, got %s and %s", first, second)
+	}
+	if second.Sub(first) != 23*time.Hour {
+		t.Fatalf("expected 23h day on spring forward, got %s", second.Sub(first))
+	}
+
+	// 02:30 nao existe em 08/03/2026: dispara as 03:00.
+	skipped, _ := ParseIn("30 2 * * *", ny)
+	got := skipped.Next(time.Date(2026, 3, 8, 0, 0, 0, 0, ny))
+	if want := time.Date(2026, 3, 8, 3, 0, 0, 0, ny); !got.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if prev := skipped.Prev(time.Date(2026, 3, 8, 10, 0, 0, 0, ny)); !prev.Equal(got) {
+		t.Fatalf("expected prev %s, got %s", got, prev)
+	}
+
+	// 01:30 acontece duas vezes em 01/11/2026: dispara apenas na primeira.
+	repeated, _ := ParseIn("30 1 * * *", ny)
+	firstFire := repeated.Next(time.Date(2026, 11, 1, 0, 0, 0, 0, ny))
+	if _, offset := firstFire.Zone(); offset != -4*3600 {
+		t.Fatalf("expected EDT occurrence, got %s", firstFire)
+	}
+	if next := repeated.Next(firstFire); next.Day() != 2 {
+		t.Fatalf("expected next fire on 02/11, got %s", next)
+	}
+	if prev := repeated.Prev(firstFire.Add(90 * time.Minute)); !prev.Equal(firstFire) {
+		t.Fatalf("expected prev %s, got %s", firstFire, prev)
+	}
+
+	// Em Sao Paulo (2018) o horario de verao comecava a 00:00: o disparo
+	// diario da meia-noite acontece as 01:00.
+	sp, err := LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("tzdata indisponivel: %v", err)
+	}
+	midnight, _ := ParseIn("@daily", sp)
+	fire := midnight.Next(time.Date(2018, 11, 3, 12, 0, 0, 0, sp))
+	if fire.Day() != 4 || fire.Hour() != 1 || fire.Minute() != 0 {
+		t.Fatalf("expected 04/11 01:00, got %s", fire)
+	}
+	if prev := midnight.Prev(time.Date(2018, 11, 4, 9, 0, 0, 0, sp)); !prev.Equal(fire) {
+		t.Fatalf("expected prev %s, got %s", fire, prev)
+	}
+}
+
+func TestBetweenListsMissedBoundaries(t *testing.T) {
+	s, _ := ParseIn("@daily", time.UTC)
+	last := time.Date(2026, 1, 17, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 20, 8, 0, 0, 0, time.UTC)
+
+	got := s.Between(last, now, 0)
+	if len(got) != 3 || !got[0].Equal(time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)) || !got[2].Equal(time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected boundaries %v", got)
+	}
+	if limited := s.Between(last, now, 2); len(limited) != 2 || !limited[1].Equal(got[2]) {
+		t.Fatalf("expected latest 2 boundaries, got %v", limited)
+	}
+}
+
+func TestForUsesTimezone(t *testing.T) {
+	cfg := config.Config{RotateAt: "00:00", RotateTimezone: "America/Sao_Paulo"}
+	s, err := For(cfg, registry.LogInput{})
+	if err != nil {
+		t.Skipf("tzdata indisponivel: %v", err)
+	}
+	next := s.Next(time.Date(2026, 1, 20, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2026, 1, 21, 3, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, next)
+	}
+	if _, err := For(config.Config{RotateAt: "00:00", RotateTimezone: "Mars/Olympus"}, registry.LogInput{}); err == nil {
+		t.Fatalf("expected error for unknown timezone")
+	}
+}
@@ -0,0 +1,268 @@
+package shipper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/registry"
+	"zid-logs/internal/state"
+	"zid-logs/internal/timestamp"
+)
+
+const (
+	CatchUpSkip    = "skip"
+	CatchUpSummary = "summary"
+)
+
+// Gap descreve um trecho do log que nao foi enviado por causa da politica de
+// atraso maximo; no modo summary e enviado no lugar das linhas.
+type Gap struct {
+	Reason         string `json:"reason"`
+	SkippedBytes   int64  `json:"skipped_bytes"`
+	FirstTimestamp int64  `json:"first_timestamp,omitempty"`
+	LastTimestamp  int64  `json:"last_timestamp,omitempty"`
+}
+
+type catchUpPolicy struct {
+	maxBytes int64
+	maxLag   time.Duration
+	mode     string
+	parser   *timestamp.Parser
+}
+
+// ValidateCatchUp valida max_backlog_bytes, max_lag e catch_up da policy.
+func ValidateCatchUp(input registry.LogInput) error {
+	_, err := parseCatchUp(input)
+	return err
+}
+
+func parseCatchUp(input registry.LogInput) (catchUpPolicy, error) {
+	policy := catchUpPolicy{maxBytes: input.Policy.MaxBacklogBytes, mode: CatchUpSkip}
+	if policy.maxBytes < 0 {
+		return catchUpPolicy{}, errors.New("max_backlog_bytes invalido")
+	}
+	parser, err := timestamp.For(input)
+	if err != nil {
+		return catchUpPolicy{}, err
+	}
+	policy.parser = parser
+	if lag := strings.TrimSpace(input.Policy.MaxLag); lag != "" {
+		d, err := time.ParseDuration(lag)
+		if err != nil || d <= 0 {
+			return catchUpPolicy{}, fmt.Errorf("max_lag invalido: %s", lag)
+		}
+		if parser == nil {
+			return catchUpPolicy{}, errors.New("max_lag exige timestamp ou timestamp_layout")
+		}
+		policy.maxLag = d
+	}
+	switch strings.ToLower(strings.TrimSpace(input.Policy.CatchUp)) {
+	case "", CatchUpSkip:
+	case CatchUpSummary:
+		policy.mode = CatchUpSummary
+	default:
+		return catchUpPolicy{}, fmt.Errorf("catch_up invalido: %s", input.Policy.CatchUp)
+	}
+	return policy, nil
+}
+
+// catchUpOffset retorna o offset a partir do qual vale a pena enviar e o
+// motivo do salto; offset igual a from significa que nada sera pulado.
+func catchUpOffset(input registry.LogInput, policy catchUpPolicy, from, size int64, now time.Time) (int64, string, error) {
+	target := from
+	reason := ""
+	if policy.maxLag > 0 {
+		off, err := offsetSince(input.Path, policy.parser, now.Add(-policy.maxLag), from)
+		if err != nil {
+			return from, "", err
+		}
+		if off > target {
+			target = off
+			reason = "max_lag " + policy.maxLag.String()
+		}
+	}
+	if policy.maxBytes > 0 && size-target > policy.maxBytes {
+		off, err := nextLineStart(input.Path, size-policy.maxBytes)
+		if err != nil {
+			return from, "", err
+		}
+		if off > target {
+			target = off
+			reason = fmt.Sprintf("max_backlog_bytes %d", policy.maxBytes)
+		}
+	}
+	if target > from {
+		// uma linha ainda sendo gravada nunca e pulada pela metade
+		end, err := lineEndBefore(input.Path, from, target)
+		if err != nil {
+			return from, "", err
+		}
+		target = end
+	}
+	if target == from {
+		reason = ""
+	}
+	return target, reason, nil
+}
+
+// lineEndBefore limita offset ao fim da ultima linha completa ate ele.
+func lineEndBefore(path string, from, offset int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return lastLineEnd(file, from, offset)
+}
+
+// nextLineStart retorna o inicio da primeira linha completa em offset ou
+// depois dele.
+func nextLineStart(path string, offset int64) (int64, error) {
+	if offset <= 0 {
+		return 0, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset-1, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	skipped, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	return offset - 1 + int64(len(skipped)), nil
+}
+
+// gapEdgeBytes limita quanto de cada ponta do trecho pulado e lido para
+// achar o primeiro e o ultimo timestamp.
+const gapEdgeBytes = 64 * 1024
+
+// describeGap resume o trecho pulado pelos offsets e pelos timestamps das
+// suas pontas, sem ler o trecho inteiro.
+func describeGap(input registry.LogInput, parser *timestamp.Parser, from, to int64) (Gap, error) {
+	gap := Gap{SkippedBytes: to - from}
+	if parser == nil {
+		return gap, nil
+	}
+	file, err := os.Open(input.Path)
+	if err != nil {
+		return gap, err
+	}
+	defer file.Close()
+
+	size := to - from
+	if size > gapEdgeBytes {
+		size = gapEdgeBytes
+	}
+	head := make([]byte, size)
+	if _, err := file.ReadAt(head, from); err != nil && !errors.Is(err, io.EOF) {
+		return gap, err
+	}
+	for _, line := range strings.Split(string(head), "\n") {
+		if ts, ok := parser.Parse(line); ok {
+			gap.FirstTimestamp = ts.Unix()
+			break
+		}
+	}
+
+	start := to - size
+	tail := make([]byte, size)
+	if _, err := file.ReadAt(tail, start); err != nil && !errors.Is(err, io.EOF) {
+		return gap, err
+	}
+	lines := strings.Split(string(tail), "\n")
+	if start > from && len(lines) > 0 {
+		// a primeira linha da janela pode estar cortada
+		lines = lines[1:]
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if ts, ok := parser.Parse(lines[i]); ok {
+			gap.LastTimestamp = ts.Unix()
+			break
+		}
+	}
+	return gap, nil
+}
+
+// applyCatchUp pula o backlog que excede a policy, registrando um evento gap.
+// No modo summary o resumo do trecho e enviado antes de avancar o checkpoint.
+func applyCatchUp(ctx context.Context, input registry.LogInput, cfg config.Config, st *state.State, cp *state.Checkpoint, size int64) error {
+	policy, err := parseCatchUp(input)
+	if err != nil {
+		return err
+	}
+	if policy.maxBytes == 0 && policy.maxLag == 0 {
+		return nil
+	}
+	now := time.Now()
+	target, reason, err := catchUpOffset(input, policy, cp.LastOffset, size, now)
+	if err != nil || target <= cp.LastOffset {
+		return err
+	}
+
+	gap, err := describeGap(input, policy.parser, cp.LastOffset, target)
+	if err != nil {
+		return err
+	}
+	gap.Reason = reason
+
+	if policy.mode == CatchUpSummary {
+		payload, err := buildPayload(input, cfg, *cp, nil)
+		if err != nil {
+			return err
+		}
+		payload.OffsetEnd = target
+		payload.Gap = &gap
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body, encoding, err := compressBody(cfg.Compression, raw)
+		if err != nil {
+			return err
+		}
+		limiter.Configure(cfg)
+		delay, err := limiter.Wait(ctx, limiterKey(input), input.Policy.MaxBytesPerSec, len(body))
+		if err != nil {
+			return err
+		}
+		cp.LastThrottleMs = delay.Milliseconds()
+		cp.ThrottleDelayMs += delay.Milliseconds()
+		cp.LastAttemptAt = time.Now().Unix()
+		statusCode, durationMs, err := postPayload(ctx, cfg, body, encoding)
+		cp.LastStatusCode = statusCode
+		cp.LastDurationMs = durationMs
+		if err != nil {
+			cp.LastError = err.Error()
+			_ = st.SaveCheckpoint(*cp)
+			return err
+		}
+	}
+
+	_ = st.AddEvent(state.Event{
+		Kind:    "gap",
+		Package: input.Package,
+		LogID:   input.LogID,
+		Path:    input.Path,
+		Detail: fmt.Sprintf("%s (%s): pulados %d bytes, offset %d -> %d",
+			reason, policy.mode, gap.SkippedBytes, cp.LastOffset, target),
+	})
+	cp.LastOffset = target
+	cp.Gaps++
+	cp.GapBytes += gap.SkippedBytes
+	cp.LastGapBytes = gap.SkippedBytes
+	cp.LastGapAt = now.Unix()
+	return st.SaveCheckpoint(*cp)
+}
@@ -0,0 +1,111 @@
+package shipper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"zid-logs/internal/config"
+)
+
+const defaultAdaptiveMinBytes = 1024
+
+// ValidateCompression confere o algoritmo e o nivel de compression: gzip e
+// deflate aceitam -2 a 9, zstd 1 a 22 (0 usa o padrao de cada um).
+func ValidateCompression(opts config.CompressionConfig) error {
+	algorithm := strings.ToLower(strings.TrimSpace(opts.Algorithm))
+	switch algorithm {
+	case "":
+		algorithm = config.CompressionGzip
+	case config.CompressionGzip, config.CompressionDeflate, config.CompressionZstd:
+	case config.CompressionNone:
+		return nil
+	default:
+		return fmt.Errorf("compression.algorithm invalido: %s", opts.Algorithm)
+	}
+	if err := config.ValidateCompressLevel(algorithm, opts.Level); err != nil {
+		return fmt.Errorf("compression.level: %w", err)
+	}
+	return nil
+}
+
+// compressBody aplica a compressao configurada e retorna o corpo junto com o
+// valor do Content-Encoding (vazio quando o corpo segue sem compressao).
+func compressBody(opts config.CompressionConfig, body []byte) ([]byte, string, error) {
+	algorithm := strings.ToLower(strings.TrimSpace(opts.Algorithm))
+	if algorithm == "" {
+		algorithm = config.CompressionGzip
+	}
+	if opts.Adaptive && algorithm != config.CompressionNone {
+		minBytes := opts.MinBytes
+		if minBytes <= 0 {
+			minBytes = defaultAdaptiveMinBytes
+		}
+		if len(body) < minBytes {
+			return body, "", nil
+		}
+	}
+
+	var buf bytes.Buffer
+	switch algorithm {
+	case config.CompressionNone:
+		return body, "", nil
+	case config.CompressionGzip:
+		level := opts.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		zw, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeAndClose(zw, body); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "gzip", nil
+	case config.CompressionDeflate:
+		level := opts.Level
+		if level == 0 {
+			level = zlib.DefaultCompression
+		}
+		zw, err := zlib.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeAndClose(zw, body); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "deflate", nil
+	case config.CompressionZstd:
+		level := zstd.SpeedDefault
+		if opts.Level != 0 {
+			level = zstd.EncoderLevelFromZstd(opts.Level)
+		}
+		zw, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeAndClose(zw, body); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "zstd", nil
+	}
+	return nil, "", fmt.Errorf("compressao invalida: %s", opts.Algorithm)
+}
+
+type writeCloser interface {
+	Write([]byte) (int, error)
+	Close() error
+}
+
+func writeAndClose(w writeCloser, body []byte) error {
+	if _, err := w.Write(body); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,148 @@
+package shipper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"zid-logs/internal/state"
+)
+
+const fingerprintBytes = 1024
+
+const (
+	IdentityTruncated = "truncated"
+	IdentityReplaced  = "replaced"
+	IdentityRotated   = "rotated"
+	IdentityMoved     = "moved"
+)
+
+// reconcileIdentity compara a identidade salva (dev+inode+fingerprint) com o
+// arquivo atual e decide a partir de qual offset continuar. O tipo de mudanca
+// retornado fica vazio quando o arquivo e o mesmo.
+func reconcileIdentity(path string, info os.FileInfo, prev state.FileIdentity, offset int64) (state.FileIdentity, int64, string, error) {
+	cur, err := fileIdentity(info)
+	if err != nil {
+		return state.FileIdentity{}, 0, "", err
+	}
+	size := info.Size()
+
+	if prev.Inode == 0 {
+		if err := fillFingerprint(path, &cur, size); err != nil {
+			return state.FileIdentity{}, 0, "", err
+		}
+		if offset > size {
+			offset = 0
+		}
+		return cur, offset, "", nil
+	}
+
+	sameInode := prev.Inode == cur.Inode && prev.Dev == cur.Dev
+	prefixMatch, err := matchesFingerprint(path, prev, size)
+	if err != nil {
+		return state.FileIdentity{}, 0, "", err
+	}
+
+	var change string
+	switch {
+	case sameInode && prefixMatch && size >= offset:
+		cur.Fingerprint = prev.Fingerprint
+		cur.FingerprintSize = prev.FingerprintSize
+		if prev.FingerprintSize < fingerprintBytes && size > prev.FingerprintSize {
+			if err := fillFingerprint(path, &cur, size); err != nil {
+				return state.FileIdentity{}, 0, "", err
+			}
+		}
+		return cur, offset, "", nil
+	case sameInode && (size < offset || size < prev.FingerprintSize):
+		change = IdentityTruncated
+		offset = 0
+	case sameInode:
+		change = IdentityReplaced
+		offset = 0
+	case prefixMatch && strongFingerprint(prev, size) && size >= offset:
+		change = IdentityMoved
+	default:
+		change = IdentityRotated
+		offset = 0
+	}
+
+	if err := fillFingerprint(path, &cur, size); err != nil {
+		return state.FileIdentity{}, 0, "", err
+	}
+	return cur, offset, change, nil
+}
+
+// strongFingerprint indica se o fingerprint salvo basta para reconhecer o
+// mesmo conteudo em outro inode: precisa cobrir os fingerprintBytes inteiros
+// ou o arquivo todo, sem que ele tenha mudado de tamanho. Um prefixo curto
+// (ex.: so a data da primeira linha) casaria com um arquivo recriado.
+func strongFingerprint(prev state.FileIdentity, size int64) bool {
+	if prev.Fingerprint == "" {
+		return false
+	}
+	return prev.FingerprintSize >= fingerprintBytes || size == prev.FingerprintSize
+}
+
+func matchesFingerprint(path string, prev state.FileIdentity, size int64) (bool, error) {
+	if prev.Fingerprint == "" {
+		return true, nil
+	}
+	if size < prev.FingerprintSize {
+		return false, nil
+	}
+	sum, err := fingerprint(path, prev.FingerprintSize)
+	if err != nil {
+		return false, err
+	}
+	return sum == prev.Fingerprint, nil
+}
+
+func fillFingerprint(path string, identity *state.FileIdentity, size int64) error {
+	n := size
+	if n > fingerprintBytes {
+		n = fingerprintBytes
+	}
+	if n <= 0 {
+		identity.Fingerprint = ""
+		identity.FingerprintSize = 0
+		return nil
+	}
+	sum, err := fingerprint(path, n)
+	if err != nil {
+		return err
+	}
+	identity.Fingerprint = sum
+	identity.FingerprintSize = n
+	return nil
+}
+
+func fingerprint(path string, n int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	copied, err := io.CopyN(h, file, n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if copied < n {
+		return "", fmt.Errorf("arquivo menor que o fingerprint: %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileIdentity(info os.FileInfo) (state.FileIdentity, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return state.FileIdentity{}, errors.New("nao foi possivel obter inode")
+	}
+	return state.FileIdentity{Dev: uint64(stat.Dev), Inode: uint64(stat.Ino)}, nil
+}
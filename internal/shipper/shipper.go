@@ -2,7 +2,6 @@ package shipper
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -11,14 +10,17 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"syscall"
 	"time"
 
 	"zid-logs/internal/config"
 	"zid-logs/internal/registry"
 	"zid-logs/internal/state"
+	"zid-logs/internal/throttle"
+	"zid-logs/internal/timestamp"
 )
 
+var limiter = throttle.NewLimiter()
+
 type Payload struct {
 	DeviceID    string   `json:"device_id"`
 	PFHostname  string   `json:"pf_hostname"`
@@ -31,6 +33,7 @@ type Payload struct {
 	SentAt      int64    `json:"sent_at"`
 	Lines       []string `json:"lines,omitempty"`
 	Raw         string   `json:"raw,omitempty"`
+	Gap         *Gap     `json:"gap,omitempty"`
 }
 
 func ShipOnce(ctx context.Context, input registry.LogInput, cfg config.Config, st *state.State) (*state.Checkpoint, error) {
@@ -56,24 +59,50 @@ func ShipOnce(ctx context.Context, input registry.LogInput, cfg config.Config, s
 			LogID:   input.LogID,
 			Path:    input.Path,
 		}
+		start, err := startOffset(input, info.Size(), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		cp.LastOffset = start
+		if start > 0 {
+			_ = st.AddEvent(state.Event{
+				Kind:    "start_position",
+				Package: input.Package,
+				LogID:   input.LogID,
+				Path:    input.Path,
+				Detail:  fmt.Sprintf("%s: inicio no offset %d de %d", input.StartPosition, start, info.Size()),
+			})
+		}
 	}
 
-	identity, err := fileIdentity(info)
+	prevIdentity, prevOffset := cp.Identity, cp.LastOffset
+	identity, offset, change, err := reconcileIdentity(input.Path, info, cp.Identity, cp.LastOffset)
 	if err != nil {
 		return nil, err
 	}
-
-	if cp.Identity.Inode != 0 && (cp.Identity.Inode != identity.Inode || cp.Identity.Dev != identity.Dev) {
-		if cp.LastOffset > info.Size() {
-			cp.LastOffset = 0
+	cp.Identity = identity
+	cp.LastOffset = offset
+	if !exists {
+		if err := st.SaveCheckpoint(cp); err != nil {
+			return nil, err
 		}
-		cp.Identity = identity
 	}
-	if cp.Identity.Inode == 0 {
-		cp.Identity = identity
+	if change != "" {
+		cp.IdentityChanges++
+		cp.LastIdentityChange = change
+		cp.LastIdentityChangeAt = time.Now().Unix()
+		_ = st.AddEvent(state.Event{
+			Kind:    "identity_" + change,
+			Package: input.Package,
+			LogID:   input.LogID,
+			Path:    input.Path,
+			Detail: fmt.Sprintf("inode %d -> %d, offset %d -> %d, tamanho %d",
+				prevIdentity.Inode, identity.Inode, prevOffset, offset, info.Size()),
+		})
 	}
-	if cp.LastOffset > info.Size() {
-		cp.LastOffset = 0
+
+	if err := applyCatchUp(ctx, input, cfg, st, &cp, info.Size()); err != nil {
+		return nil, err
 	}
 
 	file, err := os.Open(input.Path)
@@ -106,9 +135,29 @@ func ShipOnce(ctx context.Context, input registry.LogInput, cfg config.Config, s
 	}
 	fillCheckpointWindow(&cp, input, payload)
 
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	body, encoding, err := compressBody(cfg.Compression, raw)
+	if err != nil {
+		return nil, err
+	}
+	cp.LastRawBytes = int64(len(raw))
+	cp.LastWireBytes = int64(len(body))
+	cp.LastEncoding = encoding
+
+	limiter.Configure(cfg)
+	delay, err := limiter.Wait(ctx, limiterKey(input), input.Policy.MaxBytesPerSec, len(body))
+	if err != nil {
+		return nil, err
+	}
+	cp.LastThrottleMs = delay.Milliseconds()
+	cp.ThrottleDelayMs += delay.Milliseconds()
+
 	cp.LastAttemptAt = time.Now().Unix()
 	cp.LastBytesSent = int64(n)
-	statusCode, durationMs, err := postPayload(ctx, cfg, payload)
+	statusCode, durationMs, err := postPayload(ctx, cfg, body, encoding)
 	cp.LastStatusCode = statusCode
 	cp.LastDurationMs = durationMs
 	if err != nil {
@@ -118,6 +167,8 @@ func ShipOnce(ctx context.Context, input registry.LogInput, cfg config.Config, s
 	}
 
 	cp.LastOffset += int64(n)
+	cp.TotalRawBytes += cp.LastRawBytes
+	cp.TotalWireBytes += cp.LastWireBytes
 	cp.LastSentAt = time.Now().Unix()
 	cp.LastError = ""
 
@@ -128,6 +179,67 @@ func ShipOnce(ctx context.Context, input registry.LogInput, cfg config.Config, s
 	return &cp, nil
 }
 
+// Pending retorna quantos bytes e linhas completas ainda nao foram enviados,
+// lendo no maximo limit bytes a partir do checkpoint.
+func Pending(input registry.LogInput, st *state.State, limit int64) (int64, int, error) {
+	if st == nil {
+		return 0, 0, errors.New("state nao inicializado")
+	}
+	info, err := os.Stat(input.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	cp, exists, err := st.GetCheckpoint(input.Package, input.LogID, input.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	offset := cp.LastOffset
+	if exists {
+		_, offset, _, err = reconcileIdentity(input.Path, info, cp.Identity, cp.LastOffset)
+	} else {
+		offset, err = startOffset(input, info.Size(), time.Now())
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if offset > info.Size() {
+		offset = 0
+	}
+	pending := info.Size() - offset
+	if pending == 0 {
+		return 0, 0, nil
+	}
+
+	file, err := os.Open(input.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	if limit <= 0 || limit > pending {
+		limit = pending
+	}
+	reader := io.NewSectionReader(file, offset, limit)
+	buf := make([]byte, 32*1024)
+	lines := 0
+	for {
+		n, err := reader.Read(buf)
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return pending, lines, nil
+}
+
+// limiterKey identifica o input no limitador de banda.
+func limiterKey(input registry.LogInput) string {
+	return input.Package + "/" + input.LogID + "/" + input.Path
+}
+
 func buildPayload(input registry.LogInput, cfg config.Config, cp state.Checkpoint, data []byte) (Payload, error) {
 	hostname, _ := os.Hostname()
 
@@ -167,19 +279,20 @@ func fillCheckpointWindow(cp *state.Checkpoint, input registry.LogInput, payload
 		return
 	}
 	cp.LastLinesSent = len(payload.Lines)
-	if input.TimestampLayout == "" {
+	parser, err := timestamp.For(input)
+	if err != nil || parser == nil {
 		return
 	}
-	start, end := parseTimestampWindow(payload.Lines, input.TimestampLayout)
+	start, end := parseTimestampWindow(payload.Lines, parser)
 	cp.LastWindowStart = start
 	cp.LastWindowEnd = end
 }
 
-func parseTimestampWindow(lines []string, layout string) (int64, int64) {
+func parseTimestampWindow(lines []string, parser *timestamp.Parser) (int64, int64) {
 	var start int64
 	var end int64
 	for _, line := range lines {
-		ts, ok := parseLineTimestamp(line, layout)
+		ts, ok := parser.Parse(line)
 		if !ok {
 			continue
 		}
@@ -191,42 +304,17 @@ func parseTimestampWindow(lines []string, layout string) (int64, int64) {
 	return start, end
 }
 
-func parseLineTimestamp(line string, layout string) (time.Time, bool) {
-	if layout == "" || len(line) < len(layout) {
-		return time.Time{}, false
-	}
-	prefix := line[:len(layout)]
-	ts, err := time.ParseInLocation(layout, prefix, time.Local)
-	if err != nil {
-		return time.Time{}, false
-	}
-	return ts, true
-}
-
-func postPayload(ctx context.Context, cfg config.Config, payload Payload) (int, int64, error) {
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	var buf bytes.Buffer
-	zw := gzip.NewWriter(&buf)
-	if _, err := zw.Write(body); err != nil {
-		_ = zw.Close()
-		return 0, 0, err
-	}
-	if err := zw.Close(); err != nil {
-		return 0, 0, err
-	}
-
+func postPayload(ctx context.Context, cfg config.Config, body []byte, encoding string) (int, int64, error) {
 	start := time.Now()
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, &buf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, bytes.NewReader(body))
 	if err != nil {
 		return 0, 0, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
 	if cfg.AuthToken != "" {
 		header := strings.TrimSpace(cfg.AuthHeaderName)
 		if header == "" {
@@ -249,11 +337,3 @@ func postPayload(ctx context.Context, cfg config.Config, payload Payload) (int,
 
 	return resp.StatusCode, time.Since(start).Milliseconds(), nil
 }
-
-func fileIdentity(info os.FileInfo) (state.FileIdentity, error) {
-	stat, ok := info.Sys().(*syscall.Stat_t)
-	if !ok {
-		return state.FileIdentity{}, errors.New("nao foi possivel obter inode")
-	}
-	return state.FileIdentity{Dev: uint64(stat.Dev), Inode: uint64(stat.Ino)}, nil
-}
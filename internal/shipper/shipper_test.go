@@ -1,17 +1,23 @@
 package shipper
 
 import (
+	"bytes"
 	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+
 	"zid-logs/internal/config"
 	"zid-logs/internal/registry"
 	"zid-logs/internal/state"
@@ -200,3 +206,498 @@ func TestShipOnceUpdatesWindowAndLines(t *testing.T) {
 		t.Fatalf("expected payload with 2 lines, got %d", len(received[0].Payload.Lines))
 	}
 }
+
+func TestPendingCountsBytesAndLines(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(logPath, []byte("a\nb\nc\npartial"), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	st, err := state.Open(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("state open: %v", err)
+	}
+	defer st.Close()
+
+	input := registry.LogInput{Package: "zid-proxy", LogID: "main", Path: logPath}
+	pending, lines, err := Pending(input, st, 0)
+	if err != nil {
+		t.Fatalf("Pending error: %v", err)
+	}
+	if pending != 13 || lines != 3 {
+		t.Fatalf("expected 13 bytes/3 lines, got %d/%d", pending, lines)
+	}
+
+	info, _ := os.Stat(logPath)
+	identity, _ := fileIdentity(info)
+	if err := st.SaveCheckpoint(state.Checkpoint{Package: input.Package, LogID: input.LogID, Path: logPath, Identity: identity, LastOffset: 4}); err != nil {
+		t.Fatalf("save checkpoint: %v", err)
+	}
+	pending, lines, err = Pending(input, st, 0)
+	if err != nil {
+		t.Fatalf("Pending error: %v", err)
+	}
+	if pending != 9 || lines != 1 {
+		t.Fatalf("expected 9 bytes/1 line, got %d/%d", pending, lines)
+	}
+}
+
+func TestCompressBodyAlgorithms(t *testing.T) {
+	body := []byte(strings.Repeat(`{"line":"2026-01-20T10:00:05-03:00 | allow"}`, 100))
+
+	cases := []struct {
+		opts     config.CompressionConfig
+		encoding string
+	}{
+		{config.CompressionConfig{}, "gzip"},
+		{config.CompressionConfig{Algorithm: "gzip", Level: 9}, "gzip"},
+		{config.CompressionConfig{Algorithm: "deflate"}, "deflate"},
+		{config.CompressionConfig{Algorithm: "zstd", Level: 3}, "zstd"},
+		{config.CompressionConfig{Algorithm: "none"}, ""},
+	}
+	for _, tc := range cases {
+		out, encoding, err := compressBody(tc.opts, body)
+		if err != nil {
+			t.Fatalf("%s: compressBody error: %v", tc.opts.Algorithm, err)
+		}
+		if encoding != tc.encoding {
+			t.Fatalf("%s: expected encoding %q, got %q", tc.opts.Algorithm, tc.encoding, encoding)
+		}
+
+		var reader io.Reader = bytes.NewReader(out)
+		switch encoding {
+		case "gzip":
+			reader, err = gzip.NewReader(reader)
+		case "deflate":
+			reader, err = zlib.NewReader(reader)
+		case "zstd":
+			var dec *zstd.Decoder
+			dec, err = zstd.NewReader(reader)
+			if err == nil {
+				defer dec.Close()
+				reader = dec
+			}
+		}
+		if err != nil {
+			t.Fatalf("%s: reader error: %v", encoding, err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%s: decode error: %v", encoding, err)
+		}
+		if !bytes.Equal(decoded, body) {
+			t.Fatalf("%s: roundtrip mismatch", encoding)
+		}
+	}
+
+	if _, _, err := compressBody(config.CompressionConfig{Algorithm: "lz4"}, body); err == nil {
+		t.Fatalf("expected error for unknown algorithm")
+	}
+
+	for _, opts := range []config.CompressionConfig{{Algorithm: " Gzip ", Level: 9}, {Algorithm: "deflate", Level: -2}, {Algorithm: "zstd", Level: 22}, {Algorithm: "none", Level: 99}} {
+		if err := ValidateCompression(opts); err != nil {
+			t.Fatalf("%+v: unexpected error %v", opts, err)
+		}
+	}
+	for _, opts := range []config.CompressionConfig{{Algorithm: "gzip", Level: 10}, {Algorithm: "deflate", Level: -3}, {Algorithm: "zstd", Level: 23}, {Algorithm: "lz4"}} {
+		if err := ValidateCompression(opts); err == nil {
+			t.Fatalf("%+v: expected validation error", opts)
+		}
+	}
+}
+
+func TestCompressBodyAdaptiveSkipsTinyPayloads(t *testing.T) {
+	opts := config.CompressionConfig{Algorithm: "zstd", Adaptive: true, MinBytes: 512}
+
+	small := []byte(`{"lines":["a"]}`)
+	out, encoding, err := compressBody(opts, small)
+	if err != nil {
+		t.Fatalf("compressBody error: %v", err)
+	}
+	if encoding != "" || !bytes.Equal(out, small) {
+		t.Fatalf("expected tiny payload sent uncompressed")
+	}
+
+	large := bytes.Repeat([]byte("x"), 1024)
+	if _, encoding, err = compressBody(opts, large); err != nil || encoding != "zstd" {
+		t.Fatalf("expected large payload compressed, got %q (%v)", encoding, err)
+	}
+}
+
+func TestReconcileIdentityDetectsChanges(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	original := []byte("2026-01-20 first line\n2026-01-20 second line\n")
+	if err := os.WriteFile(logPath, original, 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	stat := func() os.FileInfo {
+		info, err := os.Stat(logPath)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		return info
+	}
+
+	base, offset, change, err := reconcileIdentity(logPath, stat(), state.FileIdentity{}, int64(len(original)))
+	if err != nil || change != "" || offset != int64(len(original)) {
+		t.Fatalf("unexpected first reconcile: %q %d %v", change, offset, err)
+	}
+	if base.Fingerprint == "" || base.FingerprintSize != int64(len(original)) {
+		t.Fatalf("expected fingerprint recorded")
+	}
+	// mantem o inode original vivo para que os arquivos novos nao o reutilizem
+	if err := os.Link(logPath, filepath.Join(dir, "keep")); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	// append keeps identity
+	appendFile(t, logPath, "third\n")
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), base, int64(len(original)))
+	if change != "" || offset != int64(len(original)) {
+		t.Fatalf("append should not change identity, got %q", change)
+	}
+
+	// copytruncate: same inode, shorter file
+	if err := os.Truncate(logPath, 0); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	appendFile(t, logPath, "new\n")
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), base, int64(len(original)))
+	if change != IdentityTruncated || offset != 0 {
+		t.Fatalf("expected truncated, got %q offset %d", change, offset)
+	}
+	// rotate_mode copytruncate zera offset e fingerprint no checkpoint
+	reset := base
+	reset.Fingerprint, reset.FingerprintSize = "", 0
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), reset, 0)
+	if change != "" || offset != 0 {
+		t.Fatalf("expected copytruncate reset to keep identity, got %q offset %d", change, offset)
+	}
+
+	// same inode rewritten with different content of the same size
+	replaced := bytes.Repeat([]byte("z"), len(original)+10)
+	if err := os.WriteFile(logPath, replaced, 0644); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), base, int64(len(original)))
+	if change != IdentityReplaced || offset != 0 {
+		t.Fatalf("expected replaced, got %q offset %d", change, offset)
+	}
+
+	// new inode with the same (short) content and size keeps the offset
+	copyPath := logPath + ".copy"
+	moveTo := func(data []byte) {
+		if err := os.WriteFile(copyPath, data, 0644); err != nil {
+			t.Fatalf("write copy: %v", err)
+		}
+		if err := os.Rename(copyPath, logPath); err != nil {
+			t.Fatalf("rename: %v", err)
+		}
+	}
+	moveTo(original)
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), base, int64(len(original)))
+	if change != IdentityMoved || offset != int64(len(original)) {
+		t.Fatalf("expected moved keeping offset, got %q offset %d", change, offset)
+	}
+
+	// a short fingerprint is not enough once the new file is bigger: a
+	// recreated log starting with the same prefix must be read from 0
+	moveTo(append(append([]byte(nil), original...), []byte("more\n")...))
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), base, int64(len(original)))
+	if change != IdentityRotated || offset != 0 {
+		t.Fatalf("expected rotated with short fingerprint, got %q offset %d", change, offset)
+	}
+
+	// with a full fingerprint a grown file on another inode is a move
+	long := bytes.Repeat([]byte("2026-01-20 long line\n"), 100)
+	moveTo(long)
+	full, _, _, err := reconcileIdentity(logPath, stat(), state.FileIdentity{}, int64(len(long)))
+	if err != nil || full.FingerprintSize != fingerprintBytes {
+		t.Fatalf("expected full fingerprint, got %+v (%v)", full, err)
+	}
+	if err := os.Link(logPath, filepath.Join(dir, "keep-long")); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	moveTo(append(append([]byte(nil), long...), []byte("more\n")...))
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), full, int64(len(long)))
+	if change != IdentityMoved || offset != int64(len(long)) {
+		t.Fatalf("expected moved with full fingerprint, got %q offset %d", change, offset)
+	}
+
+	// new inode with other content is a rotation
+	if err := os.WriteFile(copyPath, []byte("rotated\n"), 0644); err != nil {
+		t.Fatalf("write rotated: %v", err)
+	}
+	if err := os.Rename(copyPath, logPath); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	_, offset, change, _ = reconcileIdentity(logPath, stat(), base, int64(len(original)))
+	if change != IdentityRotated || offset != 0 {
+		t.Fatalf("expected rotated, got %q offset %d", change, offset)
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+}
+
+func TestStartPositionForNewInputs(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	layout := "2006-01-02 15:04:05"
+	now := time.Now()
+	old := now.Add(-48*time.Hour).Format(layout) + " old\n"
+	recent := now.Add(-30*time.Minute).Format(layout) + " recent\n"
+	if err := os.WriteFile(logPath, []byte(old+recent), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+	size := int64(len(old) + len(recent))
+
+	cases := []struct {
+		spec string
+		want int64
+	}{
+		{"", 0},
+		{"beginning", 0},
+		{"end", size},
+		{"offset:5", 5},
+		{"offset:999999", size},
+		{"since:1h", int64(len(old))},
+		{"since:1m", size},
+	}
+	for _, tc := range cases {
+		input := registry.LogInput{Path: logPath, TimestampLayout: layout, StartPosition: tc.spec}
+		got, err := startOffset(input, size, now)
+		if err != nil {
+			t.Fatalf("%q: startOffset error: %v", tc.spec, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q: expected %d, got %d", tc.spec, tc.want, got)
+		}
+	}
+
+	for _, spec := range []string{"middle", "since:abc", "offset:-1"} {
+		if _, err := ParseStartPosition(spec); err == nil {
+			t.Fatalf("%q: expected error", spec)
+		}
+	}
+	if _, err := startOffset(registry.LogInput{Path: logPath, StartPosition: "since:1h"}, size, now); err == nil {
+		t.Fatalf("expected error for since without layout")
+	}
+
+	epochPath := filepath.Join(dir, "epoch.log")
+	epochOld := fmt.Sprintf("level=info ts=%d msg=old\n", now.Add(-48*time.Hour).Unix())
+	epochRecent := fmt.Sprintf("level=info ts=%d msg=recent\n", now.Add(-30*time.Minute).Unix())
+	if err := os.WriteFile(epochPath, []byte(epochOld+epochRecent), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+	input := registry.LogInput{
+		Path:          epochPath,
+		StartPosition: "since:1h",
+		Timestamp:     &registry.TimestampConfig{Mode: "epoch", Regex: `ts=(\d+)`},
+	}
+	got, err := startOffset(input, int64(len(epochOld+epochRecent)), now)
+	if err != nil || got != int64(len(epochOld)) {
+		t.Fatalf("expected epoch since offset %d, got %d (%v)", len(epochOld), got, err)
+	}
+}
+
+func TestShipOnceStartAtEndShipsOnlyNewData(t *testing.T) {
+	var received []Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		var payload Payload
+		_ = json.NewDecoder(gz).Decode(&payload)
+		received = append(received, payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	history := []byte("years\nof\nhistory\n")
+	if err := os.WriteFile(logPath, history, 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	st, err := state.Open(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("state open: %v", err)
+	}
+	defer st.Close()
+
+	cfg := config.Config{Endpoint: server.URL, ShipFormat: "lines", MaxBytesPerShip: 1024}
+	input := registry.LogInput{Package: "zid-proxy", LogID: "main", Path: logPath, StartPosition: "end"}
+
+	if _, err := ShipOnce(context.Background(), input, cfg, st); err != nil {
+		t.Fatalf("ShipOnce error: %v", err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("expected nothing shipped, got %d payloads", len(received))
+	}
+
+	appendFile(t, logPath, "fresh\n")
+	if _, err := ShipOnce(context.Background(), input, cfg, st); err != nil {
+		t.Fatalf("ShipOnce error: %v", err)
+	}
+	if len(received) != 1 || len(received[0].Lines) != 1 || received[0].Lines[0] != "fresh" {
+		t.Fatalf("expected only fresh line, got %+v", received)
+	}
+	if received[0].OffsetStart != int64(len(history)) {
+		t.Fatalf("unexpected offset_start %d", received[0].OffsetStart)
+	}
+}
+
+func TestShipOnceCatchUpSkipsOldBacklog(t *testing.T) {
+	var received []Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		var payload Payload
+		_ = json.NewDecoder(gz).Decode(&payload)
+		received = append(received, payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	layout := "2006-01-02 15:04:05"
+	now := time.Now()
+	var old strings.Builder
+	first := now.Add(-72 * time.Hour)
+	last := first.Add(4 * time.Minute)
+	for i := 0; i < 5; i++ {
+		old.WriteString(first.Add(time.Duration(i)*time.Minute).Format(layout) + " old\n")
+	}
+	recent := now.Add(-10*time.Minute).Format(layout) + " recent\n"
+
+	st, err := state.Open(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("state open: %v", err)
+	}
+	defer st.Close()
+	cfg := config.Config{Endpoint: server.URL, ShipFormat: "lines", MaxBytesPerShip: 4096}
+
+	for _, mode := range []string{CatchUpSkip, CatchUpSummary} {
+		received = nil
+		logPath := filepath.Join(dir, mode+".log")
+		if err := os.WriteFile(logPath, []byte(old.String()+recent), 0644); err != nil {
+			t.Fatalf("write log: %v", err)
+		}
+		input := registry.LogInput{
+			Package:         "zid-proxy",
+			LogID:           mode,
+			Path:            logPath,
+			TimestampLayout: layout,
+			Policy:          registry.InputPolicy{MaxLag: "1h", CatchUp: mode},
+		}
+
+		cp, err := ShipOnce(context.Background(), input, cfg, st)
+		if err != nil {
+			t.Fatalf("%s: ShipOnce error: %v", mode, err)
+		}
+		if cp.Gaps != 1 || cp.GapBytes != int64(old.Len()) {
+			t.Fatalf("%s: unexpected gap stats %d/%d", mode, cp.Gaps, cp.GapBytes)
+		}
+
+		var lines []Payload
+		var gaps []Payload
+		for _, payload := range received {
+			if payload.Gap != nil {
+				gaps = append(gaps, payload)
+			} else {
+				lines = append(lines, payload)
+			}
+		}
+		if len(lines) != 1 || len(lines[0].Lines) != 1 || !strings.HasSuffix(lines[0].Lines[0], "recent") {
+			t.Fatalf("%s: expected only recent line, got %+v", mode, lines)
+		}
+		wantSummaries := 0
+		if mode == CatchUpSummary {
+			wantSummaries = 1
+		}
+		if len(gaps) != wantSummaries {
+			t.Fatalf("%s: expected %d summaries, got %d", mode, wantSummaries, len(gaps))
+		}
+		if wantSummaries == 1 && (gaps[0].Gap.FirstTimestamp != first.Unix() || gaps[0].Gap.LastTimestamp != last.Unix() || gaps[0].OffsetEnd != int64(old.Len())) {
+			t.Fatalf("%s: unexpected summary %+v", mode, gaps[0].Gap)
+		}
+	}
+
+	events, err := st.ListEvents(10)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	gapEvents := 0
+	for _, ev := range events {
+		if ev.Kind == "gap" {
+			gapEvents++
+		}
+	}
+	if gapEvents != 2 {
+		t.Fatalf("expected 2 gap events, got %d", gapEvents)
+	}
+}
+
+func TestCatchUpOffsetMaxBacklogBytes(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	data := "aaaaaaaaa\nbbbbbbbbb\nccccccccc\n"
+	if err := os.WriteFile(logPath, []byte(data), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+	input := registry.LogInput{Path: logPath, Policy: registry.InputPolicy{MaxBacklogBytes: 15}}
+	policy, err := parseCatchUp(input)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	target, reason, err := catchUpOffset(input, policy, 0, int64(len(data)), time.Now())
+	if err != nil {
+		t.Fatalf("catchUpOffset: %v", err)
+	}
+	if target != 20 || reason == "" {
+		t.Fatalf("expected skip to line boundary 20, got %d (%q)", target, reason)
+	}
+
+	// todas as linhas antigas e a ultima ainda sem '\n': o pedaco fica
+	layout := "2006-01-02 15:04:05"
+	old := time.Now().Add(-48 * time.Hour).Format(layout)
+	data = old + " a\n" + old + " b\n" + old + " parcial"
+	if err := os.WriteFile(logPath, []byte(data), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+	input = registry.LogInput{Path: logPath, TimestampLayout: layout, Policy: registry.InputPolicy{MaxLag: "1h"}}
+	if policy, err = parseCatchUp(input); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	target, _, err = catchUpOffset(input, policy, 0, int64(len(data)), time.Now())
+	if want := int64(2 * (len(old) + 3)); err != nil || target != want {
+		t.Fatalf("expected skip to last complete line %d, got %d (%v)", want, target, err)
+	}
+
+	for _, bad := range []registry.InputPolicy{{MaxLag: "1h"}, {MaxLag: "x"}, {CatchUp: "drop"}, {MaxBacklogBytes: -1}} {
+		if err := ValidateCatchUp(registry.LogInput{Path: logPath, Policy: bad}); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package shipper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"zid-logs/internal/registry"
+	"zid-logs/internal/timestamp"
+)
+
+const (
+	StartBeginning = "beginning"
+	StartEnd       = "end"
+	StartSince     = "since"
+	StartOffset    = "offset"
+)
+
+type StartPosition struct {
+	Kind   string
+	Since  time.Duration
+	Offset int64
+}
+
+// ParseStartPosition interpreta start_position: beginning, end,
+// since:<duracao> ou offset:<n>. Vazio equivale a beginning.
+func ParseStartPosition(spec string) (StartPosition, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, StartBeginning) {
+		return StartPosition{Kind: StartBeginning}, nil
+	}
+	if strings.EqualFold(spec, StartEnd) {
+		return StartPosition{Kind: StartEnd}, nil
+	}
+	kind, value, ok := strings.Cut(spec, ":")
+	if !ok {
+		return StartPosition{}, fmt.Errorf("start_position invalido: %s", spec)
+	}
+	switch strings.ToLower(kind) {
+	case StartSince:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return StartPosition{}, fmt.Errorf("start_position invalido: %s", spec)
+		}
+		return StartPosition{Kind: StartSince, Since: d}, nil
+	case StartOffset:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || n < 0 {
+			return StartPosition{}, fmt.Errorf("start_position invalido: %s", spec)
+		}
+		return StartPosition{Kind: StartOffset, Offset: n}, nil
+	}
+	return StartPosition{}, fmt.Errorf("start_position invalido: %s", spec)
+}
+
+// startOffset calcula o offset inicial de um input sem checkpoint.
+func startOffset(input registry.LogInput, size int64, now time.Time) (int64, error) {
+	pos, err := ParseStartPosition(input.StartPosition)
+	if err != nil {
+		return 0, err
+	}
+	switch pos.Kind {
+	case StartEnd:
+		return size, nil
+	case StartOffset:
+		if pos.Offset > size {
+			return size, nil
+		}
+		return pos.Offset, nil
+	case StartSince:
+		parser, err := timestamp.For(input)
+		if err != nil {
+			return 0, err
+		}
+		if parser == nil {
+			return 0, errors.New("start_position since exige timestamp ou timestamp_layout")
+		}
+		return offsetSince(input.Path, parser, now.Add(-pos.Since), 0)
+	}
+	return 0, nil
+}
+
+// offsetSince retorna o inicio da primeira linha a partir de from com
+// timestamp >= since (busca binaria, como o corte da rotacao). Quando todas
+// as linhas sao anteriores retorna o fim da ultima linha completa, para nao
+// enviar depois um pedaco de linha.
+func offsetSince(path string, parser *timestamp.Parser, since time.Time, from int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if from >= size {
+		return from, nil
+	}
+
+	offset, err := parser.FindOffset(file, from, size, since)
+	if err != nil || offset < size {
+		return offset, err
+	}
+	return lastLineEnd(file, from, size)
+}
+
+// lastLineEnd retorna o offset logo depois do ultimo '\n' entre from e size,
+// ou from quando nao ha linha completa.
+func lastLineEnd(r io.ReaderAt, from, size int64) (int64, error) {
+	buf := make([]byte, 32*1024)
+	for end := size; end > from; {
+		start := end - int64(len(buf))
+		if start < from {
+			start = from
+		}
+		chunk := buf[:end-start]
+		if _, err := r.ReadAt(chunk, start); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return from, nil
+}
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -10,29 +11,138 @@ import (
 )
 
 const checkpointBucket = "checkpoints"
+const eventsBucket = "events"
+const rotationsBucket = "rotations"
+const historyBucket = "rotation_history"
+const archivesBucket = "archives"
 const keySeparator = "\x1f"
+const maxEvents = 500
+const maxHistory = 1000
 
 type FileIdentity struct {
-	Dev   uint64 `json:"dev"`
-	Inode uint64 `json:"inode"`
+	Dev             uint64 `json:"dev"`
+	Inode           uint64 `json:"inode"`
+	Fingerprint     string `json:"fingerprint,omitempty"`
+	FingerprintSize int64  `json:"fingerprint_size,omitempty"`
+}
+
+type Event struct {
+	Time    int64  `json:"time"`
+	Kind    string `json:"kind"`
+	Package string `json:"package"`
+	LogID   string `json:"log_id"`
+	Path    string `json:"path"`
+	Detail  string `json:"detail,omitempty"`
 }
 
 type Checkpoint struct {
-	Package         string       `json:"package"`
-	LogID           string       `json:"log_id"`
-	Path            string       `json:"path"`
-	Identity        FileIdentity `json:"identity"`
-	LastOffset      int64        `json:"last_offset"`
-	LastSentAt      int64        `json:"last_sent_at"`
-	LastError       string       `json:"last_error"`
-	LastAttemptAt   int64        `json:"last_attempt_at"`
-	LastStatusCode  int          `json:"last_status_code"`
-	LastBytesSent   int64        `json:"last_bytes_sent"`
-	LastLinesSent   int          `json:"last_lines_sent"`
-	LastWindowStart int64        `json:"last_window_start"`
-	LastWindowEnd   int64        `json:"last_window_end"`
-	LastDurationMs  int64        `json:"last_duration_ms"`
-	LastRotateAt    int64        `json:"last_rotate_at"`
+	Package              string       `json:"package"`
+	LogID                string       `json:"log_id"`
+	Path                 string       `json:"path"`
+	Identity             FileIdentity `json:"identity"`
+	LastOffset           int64        `json:"last_offset"`
+	LastSentAt           int64        `json:"last_sent_at"`
+	LastError            string       `json:"last_error"`
+	LastAttemptAt        int64        `json:"last_attempt_at"`
+	LastStatusCode       int          `json:"last_status_code"`
+	LastBytesSent        int64        `json:"last_bytes_sent"`
+	LastLinesSent        int          `json:"last_lines_sent"`
+	LastWindowStart      int64        `json:"last_window_start"`
+	LastWindowEnd        int64        `json:"last_window_end"`
+	LastDurationMs       int64        `json:"last_duration_ms"`
+	LastRotateAt         int64        `json:"last_rotate_at"`
+	LastThrottleMs       int64        `json:"last_throttle_ms"`
+	ThrottleDelayMs      int64        `json:"throttle_delay_ms"`
+	LastEncoding         string       `json:"last_encoding"`
+	IdentityChanges      int          `json:"identity_changes"`
+	LastIdentityChange   string       `json:"last_identity_change"`
+	LastIdentityChangeAt int64        `json:"last_identity_change_at"`
+	LastRawBytes         int64        `json:"last_raw_bytes"`
+	LastWireBytes        int64        `json:"last_wire_bytes"`
+	TotalRawBytes        int64        `json:"total_raw_bytes"`
+	TotalWireBytes       int64        `json:"total_wire_bytes"`
+	Gaps                 int          `json:"gaps"`
+	GapBytes             int64        `json:"gap_bytes"`
+	LastGapBytes         int64        `json:"last_gap_bytes"`
+	LastGapAt            int64        `json:"last_gap_at"`
+	LastRotateBoundary   int64        `json:"last_rotate_boundary"`
+	PreRotate            HookRun      `json:"pre_rotate"`
+	PostRotate           HookRun      `json:"post_rotate"`
+}
+
+// HookRun e a ultima execucao de um hook de rotacao.
+type HookRun struct {
+	At         int64  `json:"at,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Rotation e o passo atual de uma rotacao em andamento, gravado antes de cada
+// passo para que uma queda no meio possa ser concluida ou desfeita na partida.
+type Rotation struct {
+	Path      string `json:"path"`
+	Step      string `json:"step"`
+	Archive   string `json:"archive,omitempty"`
+	Staged    string `json:"staged,omitempty"`
+	CutOffset int64  `json:"cut_offset,omitempty"`
+	Period    int64  `json:"period,omitempty"`
+	StartedAt int64  `json:"started_at"`
+}
+
+// RotationRecord e uma entrada do historico de rotacoes: o que disparou, o
+// arquivo gerado (tamanho no fim da rotacao), e o que hooks e compressao
+// fizeram.
+type RotationRecord struct {
+	Time         int64            `json:"time"`
+	Package      string           `json:"package"`
+	LogID        string           `json:"log_id"`
+	Path         string           `json:"path"`
+	Trigger      string           `json:"trigger"`
+	Result       string           `json:"result"`
+	Error        string           `json:"error,omitempty"`
+	Archive      string           `json:"archive,omitempty"`
+	ArchiveBytes int64            `json:"archive_bytes"`
+	CutTime      int64            `json:"cut_time,omitempty"`
+	DurationMs   int64            `json:"duration_ms"`
+	PreRotate    *HookRun         `json:"pre_rotate,omitempty"`
+	PostRotate   *HookRun         `json:"post_rotate,omitempty"`
+	Compressed   []CompressionRun `json:"compressed,omitempty"`
+}
+
+// CompressionRun e a compressao de um arquivo rotacionado.
+type CompressionRun struct {
+	Archive    string `json:"archive"`
+	Format     string `json:"format"`
+	RawBytes   int64  `json:"raw_bytes"`
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ArchiveEntry e uma geracao rotacionada no catalogo. Name e o nome do arquivo
+// rotacionado sem a extensao de compressao; Size, SHA256 e os timestamps
+// descrevem o conteudo sem compressao. Shipped indica que o envio ja tinha
+// passado do fim do arquivo quando ele foi rotacionado.
+type ArchiveEntry struct {
+	Package        string `json:"package"`
+	LogID          string `json:"log_id"`
+	Path           string `json:"path"`
+	Name           string `json:"name"`
+	File           string `json:"file,omitempty"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size,omitempty"`
+	FirstTime      int64  `json:"first_time,omitempty"`
+	LastTime       int64  `json:"last_time,omitempty"`
+	SHA256         string `json:"sha256"`
+	Shipped        bool   `json:"shipped"`
+	RotatedAt      int64  `json:"rotated_at"`
+}
+
+// Contains informa se o instante at esta entre o primeiro e o ultimo
+// timestamp do arquivo.
+func (e ArchiveEntry) Contains(at int64) bool {
+	return e.FirstTime > 0 && e.FirstTime <= at && at <= e.LastTime
 }
 
 type State struct {
@@ -117,13 +227,328 @@ func (s *State) SaveCheckpoint(cp Checkpoint) error {
 	})
 }
 
-func (s *State) ensureBuckets() error {
+func (s *State) DeleteCheckpoint(pkg, logID, path string) error {
+	key := checkpointKey(pkg, logID, path)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(checkpointBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", checkpointBucket)
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// AddEvent grava um evento e descarta os mais antigos alem de maxEvents.
+func (s *State) AddEvent(ev Event) error {
+	if ev.Time == 0 {
+		ev.Time = time.Now().Unix()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(eventsBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", eventsBucket)
+		}
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(sequenceKey(seq), data); err != nil {
+			return err
+		}
+		return trimBucket(bucket, maxEvents)
+	})
+}
+
+// ListEvents retorna ate limit eventos, do mais recente para o mais antigo.
+func (s *State) ListEvents(limit int) ([]Event, error) {
+	var events []Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(eventsBucket))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(events) >= limit {
+				break
+			}
+			var ev Event
+			if err := json.Unmarshal(v, &ev); err != nil {
+				continue
+			}
+			events = append(events, ev)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// SaveRotation grava (ou substitui) o passo da rotacao em andamento do path.
+func (s *State) SaveRotation(r Rotation) error {
+	if r.StartedAt == 0 {
+		r.StartedAt = time.Now().Unix()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
 	return s.db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(checkpointBucket))
+		bucket := tx.Bucket([]byte(rotationsBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", rotationsBucket)
+		}
+		return bucket.Put([]byte(r.Path), data)
+	})
+}
+
+// DeleteRotation marca a rotacao do path como concluida.
+func (s *State) DeleteRotation(path string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(rotationsBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", rotationsBucket)
+		}
+		return bucket.Delete([]byte(path))
+	})
+}
+
+// ListRotations retorna as rotacoes que nao terminaram.
+func (s *State) ListRotations() ([]Rotation, error) {
+	var rotations []Rotation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(rotationsBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var r Rotation
+			if err := json.Unmarshal(v, &r); err != nil {
+				return nil
+			}
+			rotations = append(rotations, r)
+			return nil
+		})
+	})
+	return rotations, err
+}
+
+// AddRotationRecord grava uma rotacao no historico e descarta as mais
+// antigas alem de maxHistory.
+func (s *State) AddRotationRecord(r RotationRecord) error {
+	if r.Time == 0 {
+		r.Time = time.Now().Unix()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
 		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", historyBucket)
+		}
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(sequenceKey(seq), data); err != nil {
+			return err
+		}
+		return trimBucket(bucket, maxHistory)
 	})
 }
 
+// AddCompression anexa uma compressao a rotacao mais recente do path (a que
+// enfileirou o trabalho); sem rotacao registrada nada e gravado.
+func (s *State) AddCompression(path string, run CompressionRun) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", historyBucket)
+		}
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r RotationRecord
+			if err := json.Unmarshal(v, &r); err != nil || r.Path != path {
+				continue
+			}
+			r.Compressed = append(r.Compressed, run)
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			return bucket.Put(append([]byte(nil), k...), data)
+		}
+		return nil
+	})
+}
+
+// ListRotationHistory retorna ate limit rotacoes, da mais recente para a mais
+// antiga; package, log_id e path vazios nao filtram.
+func (s *State) ListRotationHistory(pkg, logID, path string, limit int) ([]RotationRecord, error) {
+	var records []RotationRecord
+	err := s.WalkRotationHistory(func(r RotationRecord) bool {
+		if (pkg != "" && r.Package != pkg) || (logID != "" && r.LogID != logID) || (path != "" && r.Path != path) {
+			return true
+		}
+		records = append(records, r)
+		return limit <= 0 || len(records) < limit
+	})
+	return records, err
+}
+
+// WalkRotationHistory percorre o historico da rotacao mais recente para a
+// mais antiga ate fn retornar false.
+func (s *State) WalkRotationHistory(fn func(RotationRecord) bool) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyBucket))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r RotationRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				continue
+			}
+			if !fn(r) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+func (s *State) SaveArchive(e ArchiveEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(archivesBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", archivesBucket)
+		}
+		return bucket.Put([]byte(e.Name), data)
+	})
+}
+
+func (s *State) GetArchive(name string) (ArchiveEntry, bool, error) {
+	var e ArchiveEntry
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(archivesBucket))
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &e)
+	})
+	return e, found, err
+}
+
+// RenameArchive acompanha a renumeracao de uma geracao; uma entrada que ja
+// exista em to e substituida, como o arquivo.
+func (s *State) RenameArchive(from, to string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(archivesBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", archivesBucket)
+		}
+		data := bucket.Get([]byte(from))
+		if data == nil {
+			return bucket.Delete([]byte(to))
+		}
+		var e ArchiveEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		e.Name = to
+		e.File = ""
+		updated, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(from)); err != nil {
+			return err
+		}
+		return bucket.Put([]byte(to), updated)
+	})
+}
+
+func (s *State) DeleteArchive(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(archivesBucket))
+		if bucket == nil {
+			return fmt.Errorf("bucket ausente: %s", archivesBucket)
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
+
+// ListArchives retorna o catalogo do log path (todos com path vazio),
+// ordenado pelo nome.
+func (s *State) ListArchives(path string) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(archivesBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var e ArchiveEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return nil
+			}
+			if path == "" || e.Path == path {
+				entries = append(entries, e)
+			}
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func (s *State) ensureBuckets() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{checkpointBucket, eventsBucket, rotationsBucket, historyBucket, archivesBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func trimBucket(bucket *bolt.Bucket, max int) error {
+	var keys [][]byte
+	c := bucket.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for i := 0; i < len(keys)-max; i++ {
+		if err := bucket.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
 func checkpointKey(pkg, logID, path string) string {
 	parts := []string{pkg, logID, path}
 	return strings.Join(parts, keySeparator)
@@ -39,3 +39,127 @@ func TestStateSaveAndGet(t *testing.T) {
 		t.Fatalf("expected offset %d, got %d", cp.LastOffset, got.LastOffset)
 	}
 }
+
+func TestEventsAreBounded(t *testing.T) {
+	st, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer st.Close()
+
+	for i := 0; i < maxEvents+5; i++ {
+		if err := st.AddEvent(Event{Kind: "identity_rotated", Package: "p", LogID: "l", Path: "/x", Time: int64(i + 1)}); err != nil {
+			t.Fatalf("AddEvent error: %v", err)
+		}
+	}
+
+	events, err := st.ListEvents(0)
+	if err != nil {
+		t.Fatalf("ListEvents error: %v", err)
+	}
+	if len(events) != maxEvents {
+		t.Fatalf("expected %d events, got %d", maxEvents, len(events))
+	}
+	if events[0].Time != int64(maxEvents+5) {
+		t.Fatalf("expected newest first, got %d", events[0].Time)
+	}
+}
+
+func TestRotationJournal(t *testing.T) {
+	st, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer st.Close()
+
+	if err := st.SaveRotation(Rotation{Path: "/var/log/a.log", Step: "shift"}); err != nil {
+		t.Fatalf("SaveRotation error: %v", err)
+	}
+	if err := st.SaveRotation(Rotation{Path: "/var/log/a.log", Step: "move", Archive: "/var/log/a.log.1"}); err != nil {
+		t.Fatalf("SaveRotation error: %v", err)
+	}
+	pending, err := st.ListRotations()
+	if err != nil || len(pending) != 1 || pending[0].Step != "move" || pending[0].StartedAt == 0 {
+		t.Fatalf("unexpected journal %+v %v", pending, err)
+	}
+	if err := st.DeleteRotation("/var/log/a.log"); err != nil {
+		t.Fatalf("DeleteRotation error: %v", err)
+	}
+	if pending, _ := st.ListRotations(); len(pending) != 0 {
+		t.Fatalf("expected empty journal, got %+v", pending)
+	}
+}
+
+func TestRotationHistory(t *testing.T) {
+	st, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer st.Close()
+
+	for i := 0; i < maxHistory+5; i++ {
+		r := RotationRecord{Package: "p", LogID: "a", Path: "/var/log/a.log", Trigger: "size", Result: "ok"}
+		if i%2 == 1 {
+			r.LogID, r.Path, r.Trigger = "b", "/var/log/b.log", "schedule"
+		}
+		if err := st.AddRotationRecord(r); err != nil {
+			t.Fatalf("AddRotationRecord error: %v", err)
+		}
+	}
+	all, err := st.ListRotationHistory("", "", "", 0)
+	if err != nil || len(all) != maxHistory {
+		t.Fatalf("expected %d records, got %d (%v)", maxHistory, len(all), err)
+	}
+
+	if err := st.AddCompression("/var/log/a.log", CompressionRun{Archive: "/var/log/a.log.2.gz", Format: "gzip", RawBytes: 100, Bytes: 10}); err != nil {
+		t.Fatalf("AddCompression error: %v", err)
+	}
+	onlyA, err := st.ListRotationHistory("p", "a", "", 3)
+	if err != nil || len(onlyA) != 3 {
+		t.Fatalf("expected 3 records for a, got %+v (%v)", onlyA, err)
+	}
+	for _, r := range onlyA {
+		if r.LogID != "a" || r.Trigger != "size" || r.Time == 0 {
+			t.Fatalf("unexpected record %+v", r)
+		}
+	}
+	if len(onlyA[0].Compressed) != 1 || onlyA[0].Compressed[0].Bytes != 10 || len(onlyA[1].Compressed) != 0 {
+		t.Fatalf("compression should be attached to the latest rotation only: %+v", onlyA[:2])
+	}
+	if latestB, _ := st.ListRotationHistory("", "", "/var/log/b.log", 1); len(latestB) != 1 || latestB[0].Compressed != nil {
+		t.Fatalf("unexpected b record %+v", latestB)
+	}
+}
+
+func TestArchiveCatalog(t *testing.T) {
+	st, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer st.Close()
+
+	for _, e := range []ArchiveEntry{
+		{Path: "/var/log/a.log", Name: "/var/log/a.log.1", SHA256: "one", FirstTime: 100, LastTime: 200},
+		{Path: "/var/log/a.log", Name: "/var/log/a.log.2", SHA256: "two", Shipped: true},
+		{Path: "/var/log/b.log", Name: "/var/log/b.log.1", SHA256: "b"},
+	} {
+		if err := st.SaveArchive(e); err != nil {
+			t.Fatalf("SaveArchive error: %v", err)
+		}
+	}
+	// a renumeracao sobrescreve a geracao de destino, como o arquivo
+	if err := st.RenameArchive("/var/log/a.log.1", "/var/log/a.log.2"); err != nil {
+		t.Fatalf("RenameArchive error: %v", err)
+	}
+	got, ok, err := st.GetArchive("/var/log/a.log.2")
+	if err != nil || !ok || got.SHA256 != "one" || got.Shipped || !got.Contains(150) || got.Contains(201) {
+		t.Fatalf("unexpected entry %+v (%v)", got, err)
+	}
+	if err := st.DeleteArchive("/var/log/b.log.1"); err != nil {
+		t.Fatalf("DeleteArchive error: %v", err)
+	}
+	entries, err := st.ListArchives("")
+	if err != nil || len(entries) != 1 || entries[0].Name != "/var/log/a.log.2" {
+		t.Fatalf("unexpected catalog %+v (%v)", entries, err)
+	}
+}
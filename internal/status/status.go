@@ -1,75 +1,147 @@
 package status
 
 import (
-	"fmt"
+	"math"
 	"os"
-	"strconv"
-	"strings"
 	"time"
 
+	"zid-logs/internal/budget"
 	"zid-logs/internal/config"
 	"zid-logs/internal/registry"
+	"zid-logs/internal/rotate"
+	"zid-logs/internal/schedule"
 	"zid-logs/internal/state"
 )
 
+const statusEventsLimit = 50
+const statusHistoryLimit = 50
+
 type InputStatus struct {
-	Package         string `json:"package"`
-	LogID           string `json:"log_id"`
-	Path            string `json:"path"`
-	Source          string `json:"source"`
-	FileSize        int64  `json:"file_size"`
-	Backlog         int64  `json:"backlog"`
-	LastOffset      int64  `json:"last_offset"`
-	LastSentAt      int64  `json:"last_sent_at"`
-	LastError       string `json:"last_error"`
-	LastAttemptAt   int64  `json:"last_attempt_at"`
-	LastStatusCode  int    `json:"last_status_code"`
-	LastBytesSent   int64  `json:"last_bytes_sent"`
-	LastLinesSent   int    `json:"last_lines_sent"`
-	LastWindowStart int64  `json:"last_window_start"`
-	LastWindowEnd   int64  `json:"last_window_end"`
-	LastDurationMs  int64  `json:"last_duration_ms"`
-	LastRotateAt    int64  `json:"last_rotate_at"`
-	IdentityDev     uint64 `json:"dev"`
-	IdentityIno     uint64 `json:"inode"`
+	Package              string                `json:"package"`
+	LogID                string                `json:"log_id"`
+	Path                 string                `json:"path"`
+	Source               string                `json:"source"`
+	Pattern              string                `json:"pattern,omitempty"`
+	FileSize             int64                 `json:"file_size"`
+	Backlog              int64                 `json:"backlog"`
+	LastOffset           int64                 `json:"last_offset"`
+	LastSentAt           int64                 `json:"last_sent_at"`
+	LastError            string                `json:"last_error"`
+	LastAttemptAt        int64                 `json:"last_attempt_at"`
+	LastStatusCode       int                   `json:"last_status_code"`
+	LastBytesSent        int64                 `json:"last_bytes_sent"`
+	LastLinesSent        int                   `json:"last_lines_sent"`
+	LastWindowStart      int64                 `json:"last_window_start"`
+	LastWindowEnd        int64                 `json:"last_window_end"`
+	LastDurationMs       int64                 `json:"last_duration_ms"`
+	LastRotateAt         int64                 `json:"last_rotate_at"`
+	RotateSchedule       string                `json:"rotate_schedule,omitempty"`
+	NextRotateAt         int64                 `json:"next_rotate_at"`
+	LastThrottleMs       int64                 `json:"last_throttle_ms"`
+	ThrottleDelayMs      int64                 `json:"throttle_delay_ms"`
+	LastEncoding         string                `json:"last_encoding"`
+	LastRatio            float64               `json:"last_compression_ratio"`
+	Ratio                float64               `json:"compression_ratio"`
+	IdentityChanges      int                   `json:"identity_changes"`
+	LastIdentityChange   string                `json:"last_identity_change"`
+	LastIdentityChangeAt int64                 `json:"last_identity_change_at"`
+	Gaps                 int                   `json:"gaps"`
+	GapBytes             int64                 `json:"gap_bytes"`
+	LastGapBytes         int64                 `json:"last_gap_bytes"`
+	LastGapAt            int64                 `json:"last_gap_at"`
+	LegalHold            bool                  `json:"legal_hold"`
+	PreRotate            *state.HookRun        `json:"pre_rotate,omitempty"`
+	PostRotate           *state.HookRun        `json:"post_rotate,omitempty"`
+	LastRotation         *state.RotationRecord `json:"last_rotation,omitempty"`
+	Archives             []state.ArchiveEntry  `json:"archives,omitempty"`
+	IdentityDev          uint64                `json:"dev"`
+	IdentityIno          uint64                `json:"inode"`
 }
 
 type Status struct {
-	GeneratedAt       int64         `json:"generated_at"`
-	Inputs            []InputStatus `json:"inputs"`
-	LastErrorGlobal   string        `json:"last_error_global"`
-	StatusWarning     string        `json:"status_warning,omitempty"`
-	TotalInputs       int           `json:"total_inputs"`
-	TotalBacklog      int64         `json:"total_backlog"`
-	LastSentAt        int64         `json:"last_sent_at"`
-	LastAttemptAt     int64         `json:"last_attempt_at"`
-	LastRotateAt      int64         `json:"last_rotate_at"`
-	NextRotateAt      int64         `json:"next_rotate_at"`
-	ShipIntervalHours int           `json:"ship_interval_hours"`
-	RotateAt          string        `json:"rotate_at"`
+	GeneratedAt       int64                  `json:"generated_at"`
+	Inputs            []InputStatus          `json:"inputs"`
+	LastErrorGlobal   string                 `json:"last_error_global"`
+	StatusWarning     string                 `json:"status_warning,omitempty"`
+	TotalInputs       int                    `json:"total_inputs"`
+	TotalBacklog      int64                  `json:"total_backlog"`
+	LastSentAt        int64                  `json:"last_sent_at"`
+	LastAttemptAt     int64                  `json:"last_attempt_at"`
+	LastRotateAt      int64                  `json:"last_rotate_at"`
+	NextRotateAt      int64                  `json:"next_rotate_at"`
+	ShipIntervalHours int                    `json:"ship_interval_hours"`
+	RotateAt          string                 `json:"rotate_at"`
+	RotateSchedule    string                 `json:"rotate_schedule,omitempty"`
+	MaxBytesPerSec    int64                  `json:"max_bytes_per_sec"`
+	ThrottleDelayMs   int64                  `json:"throttle_delay_ms"`
+	TotalGapBytes     int64                  `json:"total_gap_bytes"`
+	Compression       string                 `json:"compression"`
+	DiskBudget        *budget.Usage          `json:"disk_budget,omitempty"`
+	Events            []state.Event          `json:"events,omitempty"`
+	RotationHistory   []state.RotationRecord `json:"rotation_history,omitempty"`
 }
 
-func Build(cfg config.Config, inputs []registry.LogInput, st *state.State, lastError string) Status {
+// Build monta o status a partir do state. O uso do disk_budget nao e medido
+// aqui: usage e a ultima medicao do daemon (nil quando nao ha).
+func Build(cfg config.Config, inputs []registry.LogInput, st *state.State, lastError string, usage *budget.Usage) Status {
 	status := Status{
 		GeneratedAt:       time.Now().Unix(),
 		LastErrorGlobal:   lastError,
 		TotalInputs:       len(inputs),
 		ShipIntervalHours: cfg.ShipIntervalHours,
 		RotateAt:          cfg.RotateAt,
+		RotateSchedule:    cfg.RotateSchedule,
+		MaxBytesPerSec:    cfg.MaxBytesPerSec,
+		Compression:       cfg.Compression.Algorithm,
 	}
 
+	// ultima rotacao de cada input e as mais recentes, lidas do historico
+	// uma unica vez e so ate achar todas
+	lastRotation := make(map[string]state.RotationRecord)
+	archives := make(map[string][]state.ArchiveEntry)
+	if st != nil {
+		wanted := make(map[string]bool, len(inputs))
+		for _, input := range inputs {
+			wanted[input.Package+"/"+input.LogID+"/"+input.Path] = true
+		}
+		_ = st.WalkRotationHistory(func(r state.RotationRecord) bool {
+			if len(status.RotationHistory) < statusHistoryLimit {
+				status.RotationHistory = append(status.RotationHistory, r)
+			}
+			key := r.Package + "/" + r.LogID + "/" + r.Path
+			if _, ok := lastRotation[key]; !ok && wanted[key] {
+				lastRotation[key] = r
+			}
+			return len(status.RotationHistory) < statusHistoryLimit || len(lastRotation) < len(wanted)
+		})
+		if entries, err := st.ListArchives(""); err == nil {
+			for _, e := range entries {
+				archives[e.Path] = append(archives[e.Path], e)
+			}
+		}
+	}
+
+	now := time.Now()
 	for _, input := range inputs {
 		item := InputStatus{
-			Package: input.Package,
-			LogID:   input.LogID,
-			Path:    input.Path,
-			Source:  input.Source,
+			Package:   input.Package,
+			LogID:     input.LogID,
+			Path:      input.Path,
+			Source:    input.Source,
+			Pattern:   input.Pattern,
+			LegalHold: input.Policy.LegalHold,
 		}
 
 		info, err := os.Stat(input.Path)
 		if err == nil {
 			item.FileSize = info.Size()
 		}
+		if r, ok := lastRotation[input.Package+"/"+input.LogID+"/"+input.Path]; ok {
+			item.LastRotation = &r
+		}
+		if entries := archives[input.Path]; len(entries) > 0 {
+			item.Archives = rotate.Present(entries)
+		}
 
 		if st != nil {
 			cp, ok, err := st.GetCheckpoint(input.Package, input.LogID, input.Path)
@@ -85,8 +157,35 @@ func Build(cfg config.Config, inputs []registry.LogInput, st *state.State, lastE
 				item.LastWindowEnd = cp.LastWindowEnd
 				item.LastDurationMs = cp.LastDurationMs
 				item.LastRotateAt = cp.LastRotateAt
+				item.LastThrottleMs = cp.LastThrottleMs
+				item.ThrottleDelayMs = cp.ThrottleDelayMs
+				item.LastEncoding = cp.LastEncoding
+				item.LastRatio = compressionRatio(cp.LastRawBytes, cp.LastWireBytes)
+				item.Ratio = compressionRatio(cp.TotalRawBytes, cp.TotalWireBytes)
+				item.IdentityChanges = cp.IdentityChanges
+				item.LastIdentityChange = cp.LastIdentityChange
+				item.LastIdentityChangeAt = cp.LastIdentityChangeAt
+				item.Gaps = cp.Gaps
+				item.GapBytes = cp.GapBytes
+				item.LastGapBytes = cp.LastGapBytes
+				item.LastGapAt = cp.LastGapAt
 				item.IdentityDev = cp.Identity.Dev
 				item.IdentityIno = cp.Identity.Inode
+				if cp.PreRotate.At > 0 {
+					run := cp.PreRotate
+					item.PreRotate = &run
+				}
+				if cp.PostRotate.At > 0 {
+					run := cp.PostRotate
+					item.PostRotate = &run
+				}
+			}
+		}
+
+		if sched, err := schedule.For(cfg, input); err == nil && sched != nil {
+			item.RotateSchedule = sched.String()
+			if next := sched.Next(now); !next.IsZero() {
+				item.NextRotateAt = next.Unix()
 			}
 		}
 
@@ -98,6 +197,8 @@ func Build(cfg config.Config, inputs []registry.LogInput, st *state.State, lastE
 		}
 
 		status.TotalBacklog += item.Backlog
+		status.ThrottleDelayMs += item.ThrottleDelayMs
+		status.TotalGapBytes += item.GapBytes
 		if item.LastSentAt > status.LastSentAt {
 			status.LastSentAt = item.LastSentAt
 		}
@@ -107,6 +208,9 @@ func Build(cfg config.Config, inputs []registry.LogInput, st *state.State, lastE
 		if item.LastRotateAt > status.LastRotateAt {
 			status.LastRotateAt = item.LastRotateAt
 		}
+		if item.NextRotateAt > 0 && (status.NextRotateAt == 0 || item.NextRotateAt < status.NextRotateAt) {
+			status.NextRotateAt = item.NextRotateAt
+		}
 		if status.LastErrorGlobal == "" && item.LastError != "" {
 			status.LastErrorGlobal = item.LastError
 		}
@@ -114,42 +218,31 @@ func Build(cfg config.Config, inputs []registry.LogInput, st *state.State, lastE
 		status.Inputs = append(status.Inputs, item)
 	}
 
-	if cfg.RotateAt != "" {
-		if next, err := nextRotateTime(time.Now(), cfg.RotateAt); err == nil {
-			status.NextRotateAt = next.Unix()
+	if st != nil {
+		if events, err := st.ListEvents(statusEventsLimit); err == nil {
+			status.Events = events
 		}
 	}
 
-	return status
-}
-
-func nextRotateTime(now time.Time, rotateAt string) (time.Time, error) {
-	hour, minute, err := parseRotateAt(rotateAt)
-	if err != nil {
-		return time.Time{}, err
+	if budget.Enabled(cfg.DiskBudget) {
+		status.DiskBudget = usage
 	}
-	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
-	if !next.After(now) {
-		next = next.Add(24 * time.Hour)
+
+	if status.NextRotateAt == 0 {
+		if sched, err := schedule.For(cfg, registry.LogInput{}); err == nil && sched != nil {
+			if next := sched.Next(now); !next.IsZero() {
+				status.NextRotateAt = next.Unix()
+			}
+		}
 	}
-	return next, nil
+
+	return status
 }
 
-func parseRotateAt(value string) (int, int, error) {
-	parts := strings.Split(strings.TrimSpace(value), ":")
-	if len(parts) == 0 || len(parts) > 2 {
-		return 0, 0, fmt.Errorf("rotate_at invalido")
-	}
-	hour, err := strconv.Atoi(parts[0])
-	if err != nil || hour < 0 || hour > 23 {
-		return 0, 0, fmt.Errorf("hora invalida")
-	}
-	minute := 0
-	if len(parts) == 2 {
-		minute, err = strconv.Atoi(parts[1])
-		if err != nil || minute < 0 || minute > 59 {
-			return 0, 0, fmt.Errorf("minuto invalido")
-		}
+// compressionRatio retorna quantas vezes o payload encolheu (raw/wire).
+func compressionRatio(raw, wire int64) float64 {
+	if raw <= 0 || wire <= 0 {
+		return 0
 	}
-	return hour, minute, nil
+	return math.Round(float64(raw)/float64(wire)*100) / 100
 }
@@ -0,0 +1,189 @@
+package stream
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/registry"
+	"zid-logs/internal/watch"
+)
+
+const (
+	ModeBatch  = "batch"
+	ModeStream = "stream"
+
+	defaultMaxLines = 500
+	defaultFlush    = time.Second
+	tickInterval    = 100 * time.Millisecond
+)
+
+type Thresholds struct {
+	MaxLines int
+	MaxBytes int64
+	Flush    time.Duration
+}
+
+func IsStream(input registry.LogInput) bool {
+	return strings.EqualFold(strings.TrimSpace(input.Mode), ModeStream)
+}
+
+func Resolve(input registry.LogInput, cfg config.Config) Thresholds {
+	th := Thresholds{
+		MaxLines: defaultMaxLines,
+		MaxBytes: int64(cfg.MaxBytesPerShip),
+		Flush:    defaultFlush,
+	}
+	if input.Stream.MaxLines > 0 {
+		th.MaxLines = input.Stream.MaxLines
+	}
+	if input.Stream.MaxBytes > 0 {
+		th.MaxBytes = input.Stream.MaxBytes
+	}
+	if input.Stream.FlushMs > 0 {
+		th.Flush = time.Duration(input.Stream.FlushMs) * time.Millisecond
+	}
+	if th.MaxBytes <= 0 {
+		th.MaxBytes = 256 * 1024
+	}
+	return th
+}
+
+// Batch retorna cfg com max_bytes_per_ship trocado por MaxBytes, para que
+// cada lote enviado do input respeite o limite do stream.
+func (th Thresholds) Batch(cfg config.Config) config.Config {
+	if th.MaxBytes > 0 {
+		cfg.MaxBytesPerShip = int(th.MaxBytes)
+	}
+	return cfg
+}
+
+// Due indica se o lote pendente deve ser enviado agora: ao atingir o limite
+// de linhas ou bytes, ou quando o primeiro dado pendente passou de Flush.
+func Due(th Thresholds, pendingBytes int64, pendingLines int, since time.Time, now time.Time) bool {
+	if pendingBytes <= 0 {
+		return false
+	}
+	if th.MaxLines > 0 && pendingLines >= th.MaxLines {
+		return true
+	}
+	if th.MaxBytes > 0 && pendingBytes >= th.MaxBytes {
+		return true
+	}
+	return !since.IsZero() && now.Sub(since) >= th.Flush
+}
+
+type Streamer struct {
+	C <-chan struct{}
+
+	mu      sync.Mutex
+	watcher watch.Watcher
+	dirty   map[string]time.Time
+	watched map[string]bool
+	notify  chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func Start(watcher watch.Watcher) *Streamer {
+	notify := make(chan struct{}, 1)
+	s := &Streamer{
+		C:       notify,
+		watcher: watcher,
+		dirty:   make(map[string]time.Time),
+		watched: make(map[string]bool),
+		notify:  notify,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Update passa a observar apenas os inputs em modo stream. Inputs novos sao
+// marcados como pendentes para drenar o que foi escrito antes do registro.
+func (s *Streamer) Update(inputs []registry.LogInput) error {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		if !IsStream(input) || seen[input.Path] {
+			continue
+		}
+		seen[input.Path] = true
+		paths = append(paths, input.Path)
+	}
+
+	s.mu.Lock()
+	for path := range s.dirty {
+		if !seen[path] {
+			delete(s.dirty, path)
+		}
+	}
+	for path := range seen {
+		if !s.watched[path] {
+			s.dirty[path] = time.Now()
+		}
+	}
+	s.watched = seen
+	s.mu.Unlock()
+
+	return s.watcher.Set(paths)
+}
+
+// Dirty retorna os caminhos com escrita pendente e o instante da primeira
+// escrita ainda nao enviada.
+func (s *Streamer) Dirty() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]time.Time, len(s.dirty))
+	for path, since := range s.dirty {
+		out[path] = since
+	}
+	return out
+}
+
+func (s *Streamer) Clear(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dirty, path)
+}
+
+func (s *Streamer) Stop() {
+	close(s.stop)
+	<-s.done
+	_ = s.watcher.Close()
+}
+
+func (s *Streamer) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case path := <-s.watcher.Events():
+			s.mu.Lock()
+			if _, ok := s.dirty[path]; !ok {
+				s.dirty[path] = time.Now()
+			}
+			s.mu.Unlock()
+			s.signal()
+		case <-ticker.C:
+			s.mu.Lock()
+			pending := len(s.dirty) > 0
+			s.mu.Unlock()
+			if pending {
+				s.signal()
+			}
+		}
+	}
+}
+
+func (s *Streamer) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zid-logs/internal/config"
+	"zid-logs/internal/registry"
+	"zid-logs/internal/watch"
+)
+
+func TestDueThresholds(t *testing.T) {
+	th := Thresholds{MaxLines: 10, MaxBytes: 1000, Flush: time.Second}
+	now := time.Now()
+
+	if Due(th, 0, 0, now.Add(-time.Hour), now) {
+		t.Fatalf("expected nothing due without pending bytes")
+	}
+	if !Due(th, 50, 10, now, now) {
+		t.Fatalf("expected due by lines")
+	}
+	if !Due(th, 1000, 1, now, now) {
+		t.Fatalf("expected due by bytes")
+	}
+	if Due(th, 50, 1, now.Add(-500*time.Millisecond), now) {
+		t.Fatalf("expected not due before flush interval")
+	}
+	if !Due(th, 50, 1, now.Add(-time.Second), now) {
+		t.Fatalf("expected due after flush interval")
+	}
+}
+
+func TestResolveDefaults(t *testing.T) {
+	cfg := config.Config{MaxBytesPerShip: 4096}
+	th := Resolve(registry.LogInput{Mode: "stream"}, cfg)
+	if th.MaxLines != defaultMaxLines || th.MaxBytes != 4096 || th.Flush != defaultFlush {
+		t.Fatalf("unexpected defaults: %+v", th)
+	}
+
+	th = Resolve(registry.LogInput{Stream: registry.StreamPolicy{MaxLines: 5, MaxBytes: 10, FlushMs: 250}}, cfg)
+	if th.MaxLines != 5 || th.MaxBytes != 10 || th.Flush != 250*time.Millisecond {
+		t.Fatalf("unexpected overrides: %+v", th)
+	}
+	if got := th.Batch(cfg).MaxBytesPerShip; got != 10 {
+		t.Fatalf("expected batch limited to stream max_bytes, got %d", got)
+	}
+}
+
+func TestStreamerMarksOnlyStreamInputs(t *testing.T) {
+	dir := t.TempDir()
+	streamPath := filepath.Join(dir, "events.log")
+	batchPath := filepath.Join(dir, "bulk.log")
+	for _, path := range []string{streamPath, batchPath} {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	s := Start(watch.NewPolling(20 * time.Millisecond))
+	defer s.Stop()
+
+	inputs := []registry.LogInput{
+		{Package: "p", LogID: "events", Path: streamPath, Mode: ModeStream},
+		{Package: "p", LogID: "bulk", Path: batchPath},
+	}
+	if err := s.Update(inputs); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	s.Clear(streamPath)
+
+	for _, path := range []string{streamPath, batchPath} {
+		if err := os.WriteFile(path, []byte("line\n"), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	deadline := time.After(2 * time.Second)
+	var dirty map[string]time.Time
+	for {
+		select {
+		case <-s.C:
+		case <-deadline:
+			t.Fatalf("expected stream input pending")
+		}
+		dirty = s.Dirty()
+		if _, ok := dirty[streamPath]; ok {
+			break
+		}
+	}
+	if _, ok := dirty[batchPath]; ok {
+		t.Fatalf("batch input should not be watched")
+	}
+}
@@ -0,0 +1,150 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zid-logs/internal/config"
+)
+
+type bucket struct {
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+type Limiter struct {
+	mu       sync.Mutex
+	global   bucket
+	inputs   map[string]*bucket
+	rate     int64
+	schedule []config.ThrottleWindow
+	now      func() time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		inputs: make(map[string]*bucket),
+		now:    time.Now,
+	}
+}
+
+func (l *Limiter) Configure(cfg config.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = cfg.MaxBytesPerSec
+	l.schedule = cfg.ThrottleSchedule
+}
+
+// Wait bloqueia ate que n bytes possam ser enviados respeitando o limite
+// global e o limite do input, e retorna quanto tempo o envio foi atrasado.
+func (l *Limiter) Wait(ctx context.Context, key string, inputRate int64, n int) (time.Duration, error) {
+	delay := l.reserve(key, inputRate, n)
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (l *Limiter) reserve(key string, inputRate int64, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	// a janela substitui apenas o limite global; o do input continua valendo
+	globalRate := l.rate
+	if window, ok := activeWindow(l.schedule, now); ok {
+		globalRate = window.MaxBytesPerSec
+	}
+
+	var delay time.Duration
+	if globalRate > 0 {
+		delay = l.global.take(globalRate, n, now)
+	}
+	if inputRate > 0 {
+		b, ok := l.inputs[key]
+		if !ok {
+			b = &bucket{}
+			l.inputs[key] = b
+		}
+		if d := b.take(inputRate, n, now); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// take consome n tokens e permite saldo negativo; o saldo devedor vira atraso.
+// A capacidade do bucket e de um segundo de trafego.
+func (b *bucket) take(rate int64, n int, now time.Time) time.Duration {
+	if b.rate != rate || b.last.IsZero() {
+		b.rate = rate
+		b.tokens = float64(rate)
+		b.last = now
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * float64(rate)
+		if b.tokens > float64(rate) {
+			b.tokens = float64(rate)
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(rate) * float64(time.Second))
+}
+
+func activeWindow(schedule []config.ThrottleWindow, now time.Time) (config.ThrottleWindow, bool) {
+	minute := now.Hour()*60 + now.Minute()
+	for _, window := range schedule {
+		start, err := ParseClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := ParseClock(window.End)
+		if err != nil {
+			continue
+		}
+		if start <= end {
+			if minute >= start && minute < end {
+				return window, true
+			}
+			continue
+		}
+		if minute >= start || minute < end {
+			return window, true
+		}
+	}
+	return config.ThrottleWindow{}, false
+}
+
+// ParseClock converte HH:MM em minutos desde a meia-noite.
+func ParseClock(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("horario invalido: %s", value)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("hora invalida: %s", value)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("minuto invalido: %s", value)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,65 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"zid-logs/internal/config"
+)
+
+func TestLimiterDelaysBurst(t *testing.T) {
+	now := time.Date(2026, 1, 20, 12, 0, 0, 0, time.Local)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.Configure(config.Config{MaxBytesPerSec: 1000})
+
+	if d := l.reserve("a", 0, 1000); d != 0 {
+		t.Fatalf("expected first second free, got %s", d)
+	}
+	if d := l.reserve("a", 0, 500); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms delay, got %s", d)
+	}
+
+	now = now.Add(2 * time.Second)
+	if d := l.reserve("a", 0, 200); d != 0 {
+		t.Fatalf("expected tokens refilled, got %s", d)
+	}
+}
+
+func TestLimiterPerInputRate(t *testing.T) {
+	now := time.Date(2026, 1, 20, 12, 0, 0, 0, time.Local)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.Configure(config.Config{})
+
+	if d := l.reserve("a", 100, 300); d != 2*time.Second {
+		t.Fatalf("expected 2s delay for input a, got %s", d)
+	}
+	if d := l.reserve("b", 100, 100); d != 0 {
+		t.Fatalf("expected input b unaffected, got %s", d)
+	}
+}
+
+func TestLimiterScheduleFullSpeedOvernight(t *testing.T) {
+	now := time.Date(2026, 1, 20, 23, 30, 0, 0, time.Local)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.Configure(config.Config{
+		MaxBytesPerSec: 100,
+		ThrottleSchedule: []config.ThrottleWindow{
+			{Start: "22:00", End: "06:00", MaxBytesPerSec: 0},
+		},
+	})
+
+	if d := l.reserve("a", 0, 10000); d != 0 {
+		t.Fatalf("expected no throttling inside window, got %s", d)
+	}
+	if d := l.reserve("b", 100, 200); d != time.Second {
+		t.Fatalf("expected per-input limit inside window, got %s", d)
+	}
+
+	now = time.Date(2026, 1, 21, 7, 0, 0, 0, time.Local)
+	if d := l.reserve("a", 0, 200); d != time.Second {
+		t.Fatalf("expected 1s delay outside window, got %s", d)
+	}
+}
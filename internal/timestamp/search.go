@@ -0,0 +1,92 @@
+package timestamp
+
+import (
+	"bufio"
+	"io"
+	"time"
+)
+
+// searchWindow e o tamanho do trecho em que a busca binaria para e passa a
+// varrer linha a linha.
+const searchWindow = 64 * 1024
+
+// FindOffset retorna o offset da primeira linha, a partir de from (inicio de
+// linha) e antes de size, com timestamp >= cutoff; sem ela retorna size. Faz
+// busca binaria por offset, ressincronizando no inicio da linha seguinte e
+// usando a primeira linha com timestamp, e so varre linearmente perto da
+// fronteira. Supoe linhas quase em ordem.
+func (p *Parser) FindOffset(r io.ReaderAt, from, size int64, cutoff time.Time) (int64, error) {
+	lo, hi := from, size
+	for hi-lo > searchWindow {
+		mid := lo + (hi-lo)/2
+		start, ts, ok, err := p.FirstAfter(r, mid, hi)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case !ok:
+			hi = mid
+		case ts.Before(cutoff):
+			lo = start
+		default:
+			hi = start
+		}
+	}
+	return p.scanOffset(r, lo, size, cutoff)
+}
+
+// FirstAfter procura, entre as linhas que comecam depois de from (ou em 0) e
+// antes de limit, a primeira com timestamp.
+func (p *Parser) FirstAfter(r io.ReaderAt, from, limit int64) (int64, time.Time, bool, error) {
+	reader := bufio.NewReader(io.NewSectionReader(r, from, limit-from))
+	pos := from
+	if from > 0 {
+		skipped, err := reader.ReadString('\n')
+		pos += int64(len(skipped))
+		if err != nil {
+			return 0, time.Time{}, false, ignoreEOF(err)
+		}
+	}
+	for pos < limit {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if ts, ok := p.Parse(line); ok {
+				return pos, ts, true, nil
+			}
+			pos += int64(len(line))
+		}
+		if err != nil {
+			return 0, time.Time{}, false, ignoreEOF(err)
+		}
+	}
+	return 0, time.Time{}, false, nil
+}
+
+// scanOffset varre a partir de from (inicio de linha) ate a primeira linha
+// com timestamp >= cutoff; sem ela retorna size.
+func (p *Parser) scanOffset(r io.ReaderAt, from, size int64, cutoff time.Time) (int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(r, from, size-from))
+	offset := from
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if ts, ok := p.Parse(line); ok && !ts.Before(cutoff) {
+				return offset, nil
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package timestamp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"zid-logs/internal/registry"
+)
+
+const (
+	ModeLayout  = "layout"
+	ModeEpoch   = "epoch"
+	ModeEpochMs = "epoch_ms"
+)
+
+// prefixSlack e quanto o timestamp no inicio da linha pode ser mais longo ou
+// mais curto que o layout (fracao de segundo, "Z" no lugar de "-03:00", dia
+// sem zero a esquerda).
+const prefixSlack = 10
+
+// Parser extrai o timestamp de uma linha de log. Um Parser nil nunca encontra
+// timestamp.
+type Parser struct {
+	layouts []string
+	regex   *regexp.Regexp
+	mode    string
+	loc     *time.Location
+}
+
+// For monta o parser do input a partir de timestamp (ou do timestamp_layout
+// legado); sem nenhum dos dois retorna nil.
+func For(input registry.LogInput) (*Parser, error) {
+	cfg := input.Timestamp
+	if cfg == nil {
+		if input.TimestampLayout == "" {
+			return nil, nil
+		}
+		return Layout(input.TimestampLayout), nil
+	}
+	return New(*cfg, input.TimestampLayout)
+}
+
+// Layout e o parser legado: um unico layout no inicio da linha, no fuso local.
+func Layout(layout string) *Parser {
+	return &Parser{layouts: []string{layout}, mode: ModeLayout, loc: time.Local}
+}
+
+// New valida a configuracao; legacyLayout entra como layout quando a lista
+// esta vazia.
+func New(cfg registry.TimestampConfig, legacyLayout string) (*Parser, error) {
+	p := &Parser{mode: strings.ToLower(strings.TrimSpace(cfg.Mode))}
+	for _, layout := range cfg.Layouts {
+		if strings.TrimSpace(layout) != "" {
+			p.layouts = append(p.layouts, layout)
+		}
+	}
+	if len(p.layouts) == 0 && legacyLayout != "" {
+		p.layouts = []string{legacyLayout}
+	}
+
+	switch p.mode {
+	case "", ModeLayout:
+		p.mode = ModeLayout
+		if len(p.layouts) == 0 {
+			return nil, errors.New("timestamp exige layouts")
+		}
+	case ModeEpoch, ModeEpochMs:
+		if len(cfg.Layouts) > 0 {
+			return nil, fmt.Errorf("timestamp.mode %s nao usa layouts", p.mode)
+		}
+	default:
+		return nil, fmt.Errorf("timestamp.mode invalido: %s", cfg.Mode)
+	}
+
+	if cfg.Regex != "" {
+		re, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("timestamp.regex invalido: %w", err)
+		}
+		if re.NumSubexp() > 1 {
+			return nil, errors.New("timestamp.regex deve ter no maximo um grupo de captura")
+		}
+		p.regex = re
+	}
+
+	loc, err := loadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	p.loc = loc
+	return p, nil
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "Local" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp.timezone invalido %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// Parse retorna o timestamp da linha. Sem regex o timestamp fica no inicio da
+// linha; com regex ele e o grupo de captura (ou o trecho casado inteiro).
+func (p *Parser) Parse(line string) (time.Time, bool) {
+	if p == nil {
+		return time.Time{}, false
+	}
+	line = strings.TrimRight(line, "\r\n")
+	exact := false
+	if p.regex != nil {
+		m := p.regex.FindStringSubmatch(line)
+		if m == nil {
+			return time.Time{}, false
+		}
+		line = strings.TrimSpace(m[len(m)-1])
+		exact = true
+	}
+
+	switch p.mode {
+	case ModeEpoch, ModeEpochMs:
+		return p.parseEpoch(line)
+	}
+	for _, layout := range p.layouts {
+		if exact {
+			if ts, err := time.ParseInLocation(layout, line, p.loc); err == nil {
+				return ts, true
+			}
+			continue
+		}
+		if ts, ok := p.parsePrefix(layout, line); ok {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parsePrefix tenta primeiro o prefixo do tamanho do layout e depois o mais
+// longo que casar dentro da folga.
+func (p *Parser) parsePrefix(layout, line string) (time.Time, bool) {
+	n := len(layout)
+	if len(line) >= n {
+		if ts, err := time.ParseInLocation(layout, line[:n], p.loc); err == nil {
+			return ts, true
+		}
+	}
+	end := len(line)
+	if end > n+prefixSlack {
+		end = n + prefixSlack
+	}
+	for i := end; i > 0 && i >= n-prefixSlack; i-- {
+		if i == n {
+			continue
+		}
+		if ts, err := time.ParseInLocation(layout, line[:i], p.loc); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseEpoch le o numero no inicio do texto: segundos (com fracao opcional)
+// ou milissegundos.
+func (p *Parser) parseEpoch(text string) (time.Time, bool) {
+	end := 0
+	for end < len(text) && (text[end] >= '0' && text[end] <= '9' || text[end] == '.' && p.mode == ModeEpoch) {
+		end++
+	}
+	if end == 0 {
+		return time.Time{}, false
+	}
+	if p.mode == ModeEpochMs {
+		ms, err := strconv.ParseInt(text[:end], 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.UnixMilli(ms).In(p.loc), true
+	}
+	sec, frac, _ := strings.Cut(text[:end], ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var nanos int64
+	if frac != "" {
+		if strings.Contains(frac, ".") {
+			return time.Time{}, false
+		}
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		nanos, err = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+	}
+	return time.Unix(s, nanos).In(p.loc), true
+}
@@ -0,0 +1,132 @@
+package timestamp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"zid-logs/internal/registry"
+)
+
+func TestLayoutsRegexAndTimezone(t *testing.T) {
+	p, err := For(registry.LogInput{Timestamp: &registry.TimestampConfig{
+		Layouts:  []string{"2006-01-02T15:04:05Z07:00", "Jan _2 15:04:05 2006"},
+		Timezone: "America/Sao_Paulo",
+	}})
+	if err != nil {
+		t.Fatalf("for: %v", err)
+	}
+	sp, _ := time.LoadLocation("America/Sao_Paulo")
+	want := time.Date(2026, 1, 20, 10, 0, 0, 0, sp)
+	cases := map[string]time.Time{
+		"2026-01-20T10:00:00-03:00 ok\n":      want,
+		"2026-01-20T13:00:00Z ok\n":           want,
+		"2026-01-20T13:00:00.250Z ok\n":       want.Add(250 * time.Millisecond),
+		"Jan 20 10:00:00 2026 segundo layout": want,
+	}
+	for line, expected := range cases {
+		ts, ok := p.Parse(line)
+		if !ok || !ts.Equal(expected) {
+			t.Fatalf("%q: expected %s, got %s (ok=%v)", line, expected, ts, ok)
+		}
+	}
+	if _, ok := p.Parse("sem timestamp\n"); ok {
+		t.Fatalf("expected no timestamp")
+	}
+
+	re, err := New(registry.TimestampConfig{
+		Layouts:  []string{"02/Jan/2006:15:04:05 -0700"},
+		Regex:    `\[([^\]]+)\]`,
+		Timezone: "UTC",
+	}, "")
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ts, ok := re.Parse(`10.0.0.1 - - [20/Jan/2026:10:00:00 -0300] "GET / HTTP/1.1" 200`)
+	if !ok || !ts.Equal(want) {
+		t.Fatalf("expected regex timestamp %s, got %s (ok=%v)", want, ts, ok)
+	}
+}
+
+func TestEpochModes(t *testing.T) {
+	epoch, err := New(registry.TimestampConfig{Mode: ModeEpoch, Regex: `ts=(\S+)`}, "")
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ts, ok := epoch.Parse("level=info ts=1768914000.5 msg=ok")
+	if !ok || !ts.Equal(time.Unix(1768914000, 500000000)) {
+		t.Fatalf("unexpected epoch %s (ok=%v)", ts, ok)
+	}
+
+	ms, err := New(registry.TimestampConfig{Mode: ModeEpochMs}, "")
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ts, ok = ms.Parse("1768914000123 linha\n")
+	if !ok || !ts.Equal(time.UnixMilli(1768914000123)) {
+		t.Fatalf("unexpected epoch_ms %s (ok=%v)", ts, ok)
+	}
+}
+
+func TestConfigErrorsAndLegacy(t *testing.T) {
+	if p, err := For(registry.LogInput{}); p != nil || err != nil {
+		t.Fatalf("expected nil parser without config, got %v %v", p, err)
+	}
+	var nilParser *Parser
+	if _, ok := nilParser.Parse("2026-01-20 10:00:00"); ok {
+		t.Fatalf("expected nil parser to find nothing")
+	}
+	legacy, err := For(registry.LogInput{TimestampLayout: "2006-01-02 15:04:05"})
+	if err != nil {
+		t.Fatalf("legacy: %v", err)
+	}
+	if _, ok := legacy.Parse("2026-01-20 10:00:00 linha"); !ok {
+		t.Fatalf("expected legacy layout to parse")
+	}
+
+	bad := []registry.TimestampConfig{
+		{},
+		{Mode: "iso"},
+		{Mode: ModeEpoch, Layouts: []string{"2006"}},
+		{Layouts: []string{"2006"}, Regex: "("},
+		{Layouts: []string{"2006"}, Regex: "(a)(b)"},
+		{Layouts: []string{"2006"}, Timezone: "Marte/Olympus"},
+	}
+	for _, cfg := range bad {
+		if _, err := New(cfg, ""); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestFindOffsetBinarySearch(t *testing.T) {
+	layout := "2006-01-02 15:04:05"
+	base := time.Date(2026, 1, 20, 0, 0, 0, 0, time.Local)
+
+	var data strings.Builder
+	for i := 0; i < 40000; i++ {
+		data.WriteString(base.Add(time.Duration(i)*time.Second).Format(layout) + fmt.Sprintf(" linha %d\n", i))
+		if i%7 == 0 {
+			data.WriteString("\tcontinuacao sem timestamp\n\tmais uma\n")
+		}
+	}
+	file := strings.NewReader(data.String())
+	size := int64(data.Len())
+	parser := Layout(layout)
+
+	for _, sec := range []int{-10, 0, 1, 7, 999, 12345, 20000, 39999, 40000, 50000} {
+		cutoff := base.Add(time.Duration(sec) * time.Second)
+		want, err := parser.scanOffset(file, 0, size, cutoff)
+		if err != nil {
+			t.Fatalf("linear scan: %v", err)
+		}
+		got, err := parser.FindOffset(file, 0, size, cutoff)
+		if err != nil {
+			t.Fatalf("binary search: %v", err)
+		}
+		if got != want {
+			t.Fatalf("cutoff +%ds: expected offset %d, got %d", sec, want, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package watch
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const pollInterval = 500 * time.Millisecond
+
+type Watcher interface {
+	Set(paths []string) error
+	Events() <-chan string
+	Close() error
+}
+
+// New tenta o backend nativo (inotify/kqueue) e cai para polling quando
+// o sistema nao oferece suporte ou a inicializacao falha.
+func New() Watcher {
+	if w, err := newNative(); err == nil {
+		return w
+	}
+	return NewPolling(pollInterval)
+}
+
+type fileSnapshot struct {
+	size    int64
+	modTime time.Time
+	inode   uint64
+	exists  bool
+}
+
+type pollingWatcher struct {
+	mu       sync.Mutex
+	paths    map[string]fileSnapshot
+	events   chan string
+	stop     chan struct{}
+	done     chan struct{}
+	interval time.Duration
+}
+
+func NewPolling(interval time.Duration) Watcher {
+	if interval <= 0 {
+		interval = pollInterval
+	}
+	w := &pollingWatcher{
+		paths:    make(map[string]fileSnapshot),
+		events:   make(chan string, 64),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		interval: interval,
+	}
+	go w.loop()
+	return w
+}
+
+func (w *pollingWatcher) Set(paths []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	next := make(map[string]fileSnapshot, len(paths))
+	for _, path := range paths {
+		if snap, ok := w.paths[path]; ok {
+			next[path] = snap
+			continue
+		}
+		next[path] = snapshot(path)
+	}
+	w.paths = next
+	return nil
+}
+
+func (w *pollingWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *pollingWatcher) Close() error {
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+func (w *pollingWatcher) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			for _, path := range w.scan() {
+				emit(w.events, path)
+			}
+		}
+	}
+}
+
+func (w *pollingWatcher) scan() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var changed []string
+	for path, prev := range w.paths {
+		cur := snapshot(path)
+		if cur != prev {
+			w.paths[path] = cur
+			if cur.exists {
+				changed = append(changed, path)
+			}
+		}
+	}
+	return changed
+}
+
+func snapshot(path string) fileSnapshot {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileSnapshot{}
+	}
+	snap := fileSnapshot{size: info.Size(), modTime: info.ModTime(), exists: true}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		snap.inode = uint64(stat.Ino)
+	}
+	return snap
+}
+
+// emit nunca bloqueia: se o consumidor estiver atrasado o evento e
+// descartado, ja que o proximo flush le o arquivo a partir do checkpoint.
+func emit(events chan string, path string) {
+	select {
+	case events <- path:
+	default:
+	}
+}
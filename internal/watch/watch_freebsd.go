@@ -0,0 +1,150 @@
+//go:build freebsd
+
+package watch
+
+import (
+	"sync"
+	"syscall"
+	"time"
+)
+
+const kqueueFflags = syscall.NOTE_WRITE | syscall.NOTE_EXTEND | syscall.NOTE_DELETE | syscall.NOTE_RENAME
+
+type kqueueWatcher struct {
+	mu      sync.Mutex
+	kq      int
+	fds     map[string]int
+	paths   map[int]string
+	missing map[string]bool
+	events  chan string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newNative() (Watcher, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(kq)
+	w := &kqueueWatcher{
+		kq:      kq,
+		fds:     make(map[string]int),
+		paths:   make(map[int]string),
+		missing: make(map[string]bool),
+		events:  make(chan string, 64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *kqueueWatcher) Set(paths []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[path] = true
+	}
+	for path, fd := range w.fds {
+		if !wanted[path] {
+			w.unwatchLocked(path, fd)
+		}
+	}
+	for path := range w.missing {
+		if !wanted[path] {
+			delete(w.missing, path)
+		}
+	}
+	for path := range wanted {
+		if _, ok := w.fds[path]; ok {
+			continue
+		}
+		if err := w.watchLocked(path); err != nil {
+			w.missing[path] = true
+		}
+	}
+	return nil
+}
+
+func (w *kqueueWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *kqueueWatcher) Close() error {
+	close(w.stop)
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, fd := range w.fds {
+		w.unwatchLocked(path, fd)
+	}
+	return syscall.Close(w.kq)
+}
+
+func (w *kqueueWatcher) watchLocked(path string) error {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	change.Fflags = kqueueFflags
+	if _, err := syscall.Kevent(w.kq, []syscall.Kevent_t{change}, nil, nil); err != nil {
+		_ = syscall.Close(fd)
+		return err
+	}
+	w.fds[path] = fd
+	w.paths[fd] = path
+	delete(w.missing, path)
+	return nil
+}
+
+// unwatchLocked fecha o descritor; o kqueue remove o filtro sozinho.
+func (w *kqueueWatcher) unwatchLocked(path string, fd int) {
+	_ = syscall.Close(fd)
+	delete(w.fds, path)
+	delete(w.paths, fd)
+}
+
+func (w *kqueueWatcher) loop() {
+	defer close(w.done)
+	events := make([]syscall.Kevent_t, 32)
+	timeout := syscall.NsecToTimespec(int64(pollInterval))
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		n, err := syscall.Kevent(w.kq, nil, events, &timeout)
+		if err != nil && err != syscall.EINTR {
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		w.mu.Lock()
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Ident)
+			path, ok := w.paths[fd]
+			if !ok {
+				continue
+			}
+			if events[i].Fflags&(syscall.NOTE_DELETE|syscall.NOTE_RENAME) != 0 {
+				w.unwatchLocked(path, fd)
+				w.missing[path] = true
+				continue
+			}
+			emit(w.events, path)
+		}
+		for path := range w.missing {
+			if err := w.watchLocked(path); err == nil {
+				emit(w.events, path)
+			}
+		}
+		w.mu.Unlock()
+	}
+}
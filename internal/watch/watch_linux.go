@@ -0,0 +1,145 @@
+//go:build linux
+
+package watch
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE
+
+type inotifyWatcher struct {
+	mu     sync.Mutex
+	file   *os.File
+	fd     int
+	dirs   map[string]int
+	wds    map[int]string
+	names  map[string]map[string]bool
+	events chan string
+	done   chan struct{}
+}
+
+func newNative() (Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotifyWatcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		dirs:   make(map[string]int),
+		wds:    make(map[int]string),
+		names:  make(map[string]map[string]bool),
+		events: make(chan string, 64),
+		done:   make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Set observa o diretorio de cada arquivo, e nao o arquivo em si, para que
+// a recriacao apos uma rotacao continue gerando eventos.
+func (w *inotifyWatcher) Set(paths []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names := make(map[string]map[string]bool)
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if names[dir] == nil {
+			names[dir] = make(map[string]bool)
+		}
+		names[dir][filepath.Base(path)] = true
+	}
+
+	var firstErr error
+	for dir := range names {
+		if _, ok := w.dirs[dir]; ok {
+			continue
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			delete(names, dir)
+			continue
+		}
+		w.dirs[dir] = wd
+		w.wds[wd] = dir
+	}
+	for dir, wd := range w.dirs {
+		if _, ok := names[dir]; ok {
+			continue
+		}
+		_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+		delete(w.dirs, dir)
+		delete(w.wds, wd)
+	}
+	w.names = names
+	return firstErr
+}
+
+func (w *inotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	err := w.file.Close()
+	<-w.done
+	return err
+}
+
+func (w *inotifyWatcher) loop() {
+	defer close(w.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return
+		}
+		w.dispatch(buf[:n])
+	}
+}
+
+func (w *inotifyWatcher) dispatch(buf []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		wd := int(int32(binary.NativeEndian.Uint32(buf[offset:])))
+		nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+		start := offset + syscall.SizeofInotifyEvent
+		end := start + nameLen
+		if end > len(buf) {
+			return
+		}
+		name := string(trimNul(buf[start:end]))
+		offset = end
+
+		dir, ok := w.wds[wd]
+		if !ok || !w.names[dir][name] {
+			continue
+		}
+		emit(w.events, filepath.Join(dir, name))
+	}
+}
+
+func trimNul(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !freebsd
+
+package watch
+
+import "errors"
+
+func newNative() (Watcher, error) {
+	return nil, errors.New("watch nativo indisponivel")
+}
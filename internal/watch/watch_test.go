@@ -0,0 +1,55 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchersReportAppends(t *testing.T) {
+	cases := map[string]func() (Watcher, error){
+		"native":  newNative,
+		"polling": func() (Watcher, error) { return NewPolling(20 * time.Millisecond), nil },
+	}
+	for name, factory := range cases {
+		t.Run(name, func(t *testing.T) {
+			w, err := factory()
+			if err != nil {
+				t.Skipf("backend indisponivel: %v", err)
+			}
+			defer w.Close()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			other := filepath.Join(dir, "other.log")
+			if err := w.Set([]string{path}); err != nil {
+				t.Fatalf("Set error: %v", err)
+			}
+
+			if err := os.WriteFile(other, []byte("x\n"), 0644); err != nil {
+				t.Fatalf("write other: %v", err)
+			}
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			if _, err := file.WriteString("b\n"); err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			file.Close()
+
+			select {
+			case got := <-w.Events():
+				if got != path {
+					t.Fatalf("expected event for %s, got %s", path, got)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("no event received")
+			}
+		})
+	}
+}
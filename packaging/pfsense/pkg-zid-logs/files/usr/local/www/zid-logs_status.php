@@ -94,6 +94,14 @@ function zidlogs_format_range($start, $end) {
                     <th><?=gettext('Rotate time')?></th>
                     <td><?=htmlspecialchars($status['rotate_at'] ?? '-');?></td>
                 </tr>
+                <?php if (!empty($status['disk_budget'])): $budget = $status['disk_budget']; ?>
+                <tr>
+                    <th><?=gettext('Disk usage')?></th>
+                    <td><?=zidlogs_format_mb($budget['used_bytes'] ?? 0);?><?=!empty($budget['max_total_mb']) ? ' / ' . intval($budget['max_total_mb']) . ' MB' : '';?></td>
+                    <th><?=gettext('Free space')?></th>
+                    <td><?=zidlogs_format_mb($budget['free_bytes'] ?? 0);?><?=(!empty($budget['over_total']) || !empty($budget['below_free'])) ? ' (' . gettext('over budget') . ')' : '';?></td>
+                </tr>
+                <?php endif; ?>
                 <tr>
                     <th><?=gettext('Last error')?></th>
                     <td colspan="3"><?=htmlspecialchars($status['last_error_global'] ?? '');?></td>
@@ -123,6 +131,7 @@ function zidlogs_format_range($start, $end) {
                     <th><?=gettext('Last window')?></th>
                     <th><?=gettext('Last duration (ms)')?></th>
                     <th><?=gettext('Last rotation')?></th>
+                    <th><?=gettext('Next rotation')?></th>
                     <th><?=gettext('Last error')?></th>
                 </tr>
             </thead>
@@ -143,6 +152,7 @@ function zidlogs_format_range($start, $end) {
                     <td><?=zidlogs_format_range($row['last_window_start'] ?? 0, $row['last_window_end'] ?? 0);?></td>
                     <td><?=intval($row['last_duration_ms']);?></td>
                     <td><?=zidlogs_format_ts($row['last_rotate_at']);?></td>
+                    <td><?=zidlogs_format_ts($row['next_rotate_at'] ?? 0);?></td>
                     <td><?=htmlspecialchars($row['last_error']);?></td>
                 </tr>
                 <?php endforeach; ?>
@@ -151,6 +161,99 @@ function zidlogs_format_range($start, $end) {
     </div>
 </div>
 
+<?php if (!empty($status['rotation_history'])): ?>
+<div class="panel panel-default">
+    <div class="panel-heading"><h2 class="panel-title"><?=gettext('Rotation history')?></h2></div>
+    <div class="panel-body">
+        <table class="table table-striped table-hover">
+            <thead>
+                <tr>
+                    <th><?=gettext('Time')?></th>
+                    <th><?=gettext('Package')?></th>
+                    <th><?=gettext('Log ID')?></th>
+                    <th><?=gettext('Trigger')?></th>
+                    <th><?=gettext('Result')?></th>
+                    <th><?=gettext('Archive')?></th>
+                    <th><?=gettext('Size')?></th>
+                    <th><?=gettext('Duration (ms)')?></th>
+                    <th><?=gettext('Error')?></th>
+                </tr>
+            </thead>
+            <tbody>
+                <?php foreach (array_slice($status['rotation_history'], 0, 10) as $row): ?>
+                <tr>
+                    <td><?=zidlogs_format_ts($row['time']);?></td>
+                    <td><?=htmlspecialchars($row['package']);?></td>
+                    <td><?=htmlspecialchars($row['log_id']);?></td>
+                    <td><?=htmlspecialchars($row['trigger']);?></td>
+                    <td><?=htmlspecialchars($row['result']);?></td>
+                    <td><?=htmlspecialchars(basename($row['archive'] ?? ''));?></td>
+                    <td><?=zidlogs_format_mb($row['archive_bytes'] ?? 0);?></td>
+                    <td><?=intval($row['duration_ms']);?></td>
+                    <td><?=htmlspecialchars($row['error'] ?? '');?></td>
+                </tr>
+                <?php endforeach; ?>
+            </tbody>
+        </table>
+    </div>
+</div>
+<?php endif; ?>
+
+<?php
+$zidlogs_catalog = array();
+foreach (($status['inputs'] ?? array()) as $input) {
+    foreach (($input['archives'] ?? array()) as $entry) {
+        $zidlogs_catalog[] = $entry;
+    }
+}
+$zidlogs_archive_at = trim($_GET['archive_at'] ?? '');
+$zidlogs_archive_ts = ($zidlogs_archive_at !== '') ? strtotime($zidlogs_archive_at) : false;
+if ($zidlogs_archive_ts !== false) {
+    $zidlogs_catalog = array_values(array_filter($zidlogs_catalog, function ($entry) use ($zidlogs_archive_ts) {
+        return !empty($entry['first_time']) && $entry['first_time'] <= $zidlogs_archive_ts && $zidlogs_archive_ts <= $entry['last_time'];
+    }));
+}
+?>
+<?php if (!empty($zidlogs_catalog) || $zidlogs_archive_at !== ''): ?>
+<div class="panel panel-default">
+    <div class="panel-heading"><h2 class="panel-title"><?=gettext('Archive catalog')?></h2></div>
+    <div class="panel-body">
+        <form method="get" class="form-inline">
+            <input type="text" name="archive_at" class="form-control input-sm" placeholder="2026-10-17 13:00" value="<?=htmlspecialchars($zidlogs_archive_at);?>" />
+            <button type="submit" class="btn btn-sm btn-default"><i class="fa fa-search"></i> <?=gettext('Find archive for time')?></button>
+        </form>
+        <table class="table table-striped table-hover">
+            <thead>
+                <tr>
+                    <th><?=gettext('Package')?></th>
+                    <th><?=gettext('Log ID')?></th>
+                    <th><?=gettext('Archive')?></th>
+                    <th><?=gettext('Size')?></th>
+                    <th><?=gettext('Compressed')?></th>
+                    <th><?=gettext('First / last line')?></th>
+                    <th><?=gettext('Shipped at rotation')?></th>
+                    <th><?=gettext('SHA-256')?></th>
+                </tr>
+            </thead>
+            <tbody>
+                <?php foreach ($zidlogs_catalog as $row): ?>
+                <tr>
+                    <td><?=htmlspecialchars($row['package']);?></td>
+                    <td><?=htmlspecialchars($row['log_id']);?></td>
+                    <td><?=htmlspecialchars(basename($row['file'] ?? $row['name']));?></td>
+                    <td><?=zidlogs_format_mb($row['size'] ?? 0);?></td>
+                    <td><?=!empty($row['compressed_size']) ? zidlogs_format_mb($row['compressed_size']) : '-';?></td>
+                    <td><?=zidlogs_format_range($row['first_time'] ?? 0, $row['last_time'] ?? 0);?></td>
+                    <td><?=!empty($row['shipped']) ? gettext('yes') : gettext('no');?></td>
+                    <td title="<?=htmlspecialchars($row['sha256'] ?? '');?>"><?=htmlspecialchars(substr($row['sha256'] ?? '', 0, 12));?></td>
+                </tr>
+                <?php endforeach; ?>
+            </tbody>
+        </table>
+    </div>
+</div>
+<?php endif; ?>
+
 <form method="post">
     <div class="panel panel-default" id="zidlogs-actions">
         <div class="panel-heading"><h2 class="panel-title"><?=gettext('Actions')?></h2></div>